@@ -0,0 +1,94 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/SWAN-community/swift-go"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// The prefix of the state value that binds the results of a storage operation
+// to the publisher that initiated it.
+const bindingPrefix = "swan-binding:"
+
+// getBinding returns the opaque state value that binds results to the
+// publisher associated with the request. If the publisher is named then all
+// the access keys with that name share a binding, otherwise the binding is to
+// the access key alone. The value is a HMAC keyed with the operator's binding
+// secret so that it can not be computed, or tested against guesses of the
+// access key or name, by anyone without the secret.
+func (c *Configuration) getBinding(r *http.Request) string {
+	v := "key:" + getAccessKey(r)
+	p := c.getPublisher(r)
+	if p != nil && p.Name != "" {
+		v = "name:" + p.Name
+	}
+	h := hmac.New(sha256.New, []byte(c.BindingSecret))
+	h.Write([]byte(v))
+	return bindingPrefix + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// setBinding adds the binding for the publisher associated with the request to
+// the state in the form q. Any binding provided by the caller is removed.
+// Results are only bound if a binding secret is configured.
+func (c *Configuration) setBinding(r *http.Request, q url.Values) {
+	v := getCallerState(q["state"])
+	if c.BindingSecret != "" {
+		v = append(v, c.getBinding(r))
+	}
+	if len(v) > 0 {
+		q["state"] = v
+	} else {
+		q.Del("state")
+	}
+}
+
+// checkBinding returns an error if the results were not initiated by the
+// publisher associated with the request. All results are allowed if a binding
+// secret is not configured.
+func (c *Configuration) checkBinding(r *http.Request, o *swift.Results) error {
+	if c.BindingSecret == "" {
+		return nil
+	}
+	b := c.getBinding(r)
+	for _, v := range o.State() {
+		if v == b {
+			return nil
+		}
+	}
+	return newError(
+		ErrorCodeNotInitiator,
+		fmt.Errorf("results were not initiated with the access key"))
+}
+
+// getCallerState returns the state values provided by the caller excluding
+// the binding.
+func getCallerState(s []string) []string {
+	a := make([]string, 0, len(s))
+	for _, v := range s {
+		if strings.HasPrefix(v, bindingPrefix) == false {
+			a = append(a, v)
+		}
+	}
+	return a
+}
@@ -0,0 +1,465 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+// Package client calls the SWAN Operator API from server side environments.
+// The methods map to the SWAN end points and return typed results.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SWAN-community/owid-go"
+	"github.com/SWAN-community/swan-go"
+	swanop "github.com/SWAN-community/swan-op-go"
+)
+
+// HTTP headers that the SWAN Operator rejects because they indicate a request
+// from a web browser. They are always removed from requests.
+var browserHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"Cookie"}
+
+// Client calls the end points of a single SWAN Operator.
+type Client struct {
+	// The scheme and host of the SWAN Operator, for example
+	// https://swan.example.com
+	BaseURL *url.URL
+	// The access key issued to the caller by the SWAN Operator.
+	AccessKey string
+	// The HTTP client used for requests. Must not have a cookie jar.
+	HTTPClient *http.Client
+	// The number of times a request is retried after a network error or a
+	// server error response. Only requests that have no effect if repeated
+	// are retried. These are Fetch, DryRunUpdate, DryRunStop, Revalidate,
+	// EvaluateStop and HomeNode. Other requests, such as Decrypt which might
+	// be single use, return the first error.
+	MaxRetries int
+	// The delay before the first retry. Doubled for each further retry.
+	RetryDelay time.Duration
+}
+
+// Raw is the raw SWAN data returned by decrypt-raw for display to the user.
+type Raw struct {
+	SWID            string   `json:"swid"`
+	Email           string   `json:"email"`
+	Salt            string   `json:"salt"`
+	Pref            string   `json:"pref"`
+	Title           string   `json:"title"`
+	BackgroundColor string   `json:"backgroundColor"`
+	MessageColor    string   `json:"messageColor"`
+	ProgressColor   string   `json:"progressColor"`
+	Message         string   `json:"message"`
+	State           []string `json:"state"`
+}
+
+// New creates a client for the SWAN Operator at the base URL with the access
+// key provided.
+func New(baseURL string, accessKey string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base URL '%s' must be http or https", baseURL)
+	}
+	return &Client{
+		BaseURL:    u,
+		AccessKey:  accessKey,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: 2,
+		RetryDelay: 100 * time.Millisecond}, nil
+}
+
+// Fetch returns the storage operation to retrieve the most current SWAN data.
+// ip is the IP address of the web browser and is used to determine the home
+// node.
+func (c *Client) Fetch(
+	ctx context.Context,
+	ip string,
+	q *swanop.FetchRequest) (*swanop.Operation, error) {
+	var o swanop.Operation
+	v := *q
+	setRemoteAddr(&v.OperationRequest, ip)
+	err := c.postJSON(ctx, "/swan/api/v2/fetch", true, &v, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Update returns the storage operation to write the values to the SWAN network.
+// ip is the IP address of the web browser and is used to determine the home
+// node.
+func (c *Client) Update(
+	ctx context.Context,
+	ip string,
+	q *swanop.UpdateRequest) (*swanop.Operation, error) {
+	var o swanop.Operation
+	v := *q
+	setRemoteAddr(&v.OperationRequest, ip)
+	err := c.postJSON(ctx, "/swan/api/v2/update", false, &v, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// FetchUpdate returns the storage operation to write the values to the SWAN
+// network and retrieve the most current data for all the other fields. ip is
+// the IP address of the web browser and is used to determine the home node.
+func (c *Client) FetchUpdate(
+	ctx context.Context,
+	ip string,
+	q *swanop.UpdateRequest) (*swanop.Operation, error) {
+	var o swanop.Operation
+	v := *q
+	setRemoteAddr(&v.OperationRequest, ip)
+	err := c.postJSON(ctx, "/swan/api/v2/fetch-update", false, &v, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Stop returns the storage operation to add a domain to the stopped domains. ip
+// is the IP address of the web browser and is used to determine the home node.
+func (c *Client) Stop(
+	ctx context.Context,
+	ip string,
+	q *swanop.StopRequest) (*swanop.Operation, error) {
+	var o swanop.Operation
+	v := *q
+	setRemoteAddr(&v.OperationRequest, ip)
+	err := c.postJSON(ctx, "/swan/api/v2/stop", false, &v, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Unstop returns the storage operation to remove domains from the stopped
+// domains. ip is the IP address of the web browser and is used to determine the
+// home node.
+func (c *Client) Unstop(
+	ctx context.Context,
+	ip string,
+	q *swanop.UnstopRequest) (*swanop.Operation, error) {
+	var o swanop.Operation
+	v := *q
+	setRemoteAddr(&v.OperationRequest, ip)
+	err := c.postJSON(ctx, "/swan/api/v2/unstop", false, &v, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Forget returns the storage operation to erase all the user's SWAN data. ip
+// is the IP address of the web browser and is used to determine the home node.
+func (c *Client) Forget(
+	ctx context.Context,
+	ip string,
+	q *swanop.ForgetRequest) (*swanop.Operation, error) {
+	var o swanop.Operation
+	v := *q
+	setRemoteAddr(&v.OperationRequest, ip)
+	err := c.postJSON(ctx, "/swan/api/v2/forget", false, &v, &o)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// DryRunUpdate validates the values of the update request and returns the
+// values that would be written without creating a storage operation.
+func (c *Client) DryRunUpdate(
+	ctx context.Context,
+	q *swanop.UpdateRequest) (*swanop.DryRun, error) {
+	var v swanop.DryRun
+	u := *q
+	u.DryRun = true
+	err := c.postJSON(ctx, "/swan/api/v2/update", true, &u, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// DryRunStop validates the values of the stop request and returns the values
+// that would be written without creating a storage operation.
+func (c *Client) DryRunStop(
+	ctx context.Context,
+	q *swanop.StopRequest) (*swanop.DryRun, error) {
+	var v swanop.DryRun
+	s := *q
+	s.DryRun = true
+	err := c.postJSON(ctx, "/swan/api/v2/stop", true, &s, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Decrypt returns the SWAN pairs from the encrypted results appended to the
+// return URL.
+func (c *Client) Decrypt(
+	ctx context.Context,
+	encrypted string) ([]*swan.Pair, error) {
+	var p []*swan.Pair
+	err := c.postJSON(
+		ctx,
+		"/swan/api/v2/decrypt",
+		false,
+		&swanop.DecryptRequest{Encrypted: encrypted},
+		&p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Revalidate returns advice on whether the pairs previously returned by
+// Decrypt can still be used. fields are the fields option used with the fetch
+// that returned the pairs, or nil if all the fields were fetched.
+func (c *Client) Revalidate(
+	ctx context.Context,
+	p []*swan.Pair,
+	fields []string) (*swanop.Revalidation, error) {
+	var v swanop.Revalidation
+	err := c.postJSON(
+		ctx,
+		"/swan/api/v2/revalidate",
+		true,
+		&swanop.RevalidateRequest{Pairs: p, Fields: fields},
+		&v)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// EvaluateStop returns which of the candidate domains are blocked by the stop
+// pair returned from Decrypt. swanop.EvaluateStopList provides the same result
+// without calling the SWAN Operator.
+func (c *Client) EvaluateStop(
+	ctx context.Context,
+	stop *swan.Pair,
+	candidates []string) (*swanop.StopEvaluation, error) {
+	var e swanop.StopEvaluation
+	err := c.postJSON(
+		ctx,
+		"/swan/api/v2/evaluate-stop",
+		true,
+		&swanop.EvaluateStopRequest{
+			Stop:       swanop.StopPair{Pair: *stop},
+			Candidates: candidates},
+		&e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// DecryptRaw returns the raw SWAN data from the encrypted results appended to
+// the return URL. Only to be used to display the data to the user.
+func (c *Client) DecryptRaw(
+	ctx context.Context,
+	encrypted string) (*Raw, error) {
+	var r Raw
+	err := c.postJSON(
+		ctx,
+		"/swan/api/v2/decrypt-raw",
+		false,
+		&swanop.DecryptRequest{Encrypted: encrypted},
+		&r)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateSWID returns a new SWID OWID created by the SWAN Operator.
+func (c *Client) CreateSWID(ctx context.Context) (*owid.OWID, error) {
+	b, err := c.postForm(ctx, "/swan/api/v1/create-swid", url.Values{}, false)
+	if err != nil {
+		return nil, err
+	}
+	return owid.FromByteArray(b)
+}
+
+// HomeNode returns the internet domain of the home node for the web browser
+// with the IP address provided.
+func (c *Client) HomeNode(ctx context.Context, ip string) (string, error) {
+	q := url.Values{}
+	q.Set("remoteAddr", ip)
+	b, err := c.postForm(ctx, "/swan/api/v1/home-node", q, true)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// setRemoteAddr sets the IP address of the web browser in the request if one is
+// provided. The SWAN Operator uses it to determine the home node.
+func setRemoteAddr(o *swanop.OperationRequest, ip string) {
+	if ip != "" {
+		o.RemoteAddr = ip
+	}
+}
+
+// postJSON posts the value v as JSON to the path and decodes the JSON response
+// into r. If retry is true then the request is retried after network errors
+// and server error responses.
+func (c *Client) postJSON(
+	ctx context.Context,
+	path string,
+	retry bool,
+	v interface{},
+	r interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	d, err := c.do(ctx, path, h, b, retry)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(d, r)
+}
+
+// postForm posts the form values to the path and returns the response body. If
+// retry is true then the request is retried after network errors and server
+// error responses.
+func (c *Client) postForm(
+	ctx context.Context,
+	path string,
+	q url.Values,
+	retry bool) ([]byte, error) {
+	h := http.Header{}
+	h.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(ctx, path, h, []byte(q.Encode()), retry)
+}
+
+// do posts the body to the path. If retry is true then the request is retried
+// after network errors and server error responses. Returns the uncompressed
+// response body if successful.
+func (c *Client) do(
+	ctx context.Context,
+	path string,
+	h http.Header,
+	b []byte,
+	retry bool) ([]byte, error) {
+	var err error
+	var d []byte
+	w := c.RetryDelay
+	n := 0
+	if retry {
+		n = c.MaxRetries
+	}
+	for i := 0; i <= n; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(w):
+			}
+			w *= 2
+		}
+		var retry bool
+		d, retry, err = c.send(ctx, path, h, b)
+		if err == nil || retry == false {
+			break
+		}
+	}
+	return d, err
+}
+
+// send makes a single request. Returns true if the request can be retried
+// when an error is returned.
+func (c *Client) send(
+	ctx context.Context,
+	path string,
+	h http.Header,
+	b []byte) ([]byte, bool, error) {
+	u := *c.BaseURL
+	u.Path = path
+	u.RawQuery = url.Values{"accessKey": []string{c.AccessKey}}.Encode()
+	r, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		u.String(),
+		bytes.NewReader(b))
+	if err != nil {
+		return nil, false, err
+	}
+	for k, v := range h {
+		r.Header[k] = v
+	}
+	for _, k := range browserHeaders {
+		r.Header.Del(k)
+	}
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	p, err := c.HTTPClient.Do(r)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer p.Body.Close()
+	d, err := readBody(p)
+	if err != nil {
+		return nil, true, err
+	}
+	if p.StatusCode != http.StatusOK {
+		e := newError(p, d)
+		return nil, p.StatusCode >= http.StatusInternalServerError, e
+	}
+	return d, false, nil
+}
+
+// readBody returns the response body decompressing it if needed.
+func readBody(p *http.Response) ([]byte, error) {
+	var r io.Reader = p.Body
+	switch strings.ToLower(p.Header.Get("Content-Encoding")) {
+	case "gzip":
+		g, err := gzip.NewReader(p.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer g.Close()
+		r = g
+	case "deflate":
+		z, err := zlib.NewReader(p.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		r = z
+	}
+	return ioutil.ReadAll(r)
+}
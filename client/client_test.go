@@ -0,0 +1,233 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SWAN-community/swan-go"
+	swanop "github.com/SWAN-community/swan-op-go"
+)
+
+// The access key used by the tests.
+const testAccessKey = "key"
+
+// newTestClient returns a client for a test server that uses the handler
+// provided. The server is closed when the test completes.
+func newTestClient(t *testing.T, h http.HandlerFunc) *Client {
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+	c, err := New(s.URL, testAccessKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.RetryDelay = time.Millisecond
+	return c
+}
+
+// checkRequest fails the test if the request is not a POST to the path with
+// the access key and without browser headers.
+func checkRequest(t *testing.T, r *http.Request, path string) {
+	if r.Method != http.MethodPost {
+		t.Errorf("expected POST but got '%s'", r.Method)
+	}
+	if r.URL.Path != path {
+		t.Errorf("expected path '%s' but got '%s'", path, r.URL.Path)
+	}
+	if r.URL.Query().Get("accessKey") != testAccessKey {
+		t.Errorf("access key missing from '%s'", r.URL)
+	}
+	for _, k := range browserHeaders {
+		if r.Header.Get(k) != "" {
+			t.Errorf("browser header '%s' present", k)
+		}
+	}
+}
+
+// sendTestJSON responds with the value v as JSON.
+func sendTestJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		checkRequest(t, r, "/swan/api/v2/fetch")
+		var q swanop.FetchRequest
+		err := json.NewDecoder(r.Body).Decode(&q)
+		if err != nil {
+			t.Error(err)
+		}
+		if q.RemoteAddr != "192.0.2.1" {
+			t.Errorf("unexpected remote address '%s'", q.RemoteAddr)
+		}
+		if q.ReturnURL != "https://pub.example/" {
+			t.Errorf("unexpected return URL '%s'", q.ReturnURL)
+		}
+		sendTestJSON(t, w, &swanop.Operation{
+			URL:      "https://node.example/op",
+			HomeNode: "node.example"})
+	})
+	q := &swanop.FetchRequest{}
+	q.ReturnURL = "https://pub.example/"
+	o, err := c.Fetch(context.Background(), "192.0.2.1", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.URL != "https://node.example/op" || o.HomeNode != "node.example" {
+		t.Fatalf("unexpected operation %+v", o)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		checkRequest(t, r, "/swan/api/v2/update")
+		var q swanop.UpdateRequest
+		err := json.NewDecoder(r.Body).Decode(&q)
+		if err != nil {
+			t.Error(err)
+		}
+		if q.Values.RawEmail != "user@example.com" {
+			t.Errorf("unexpected raw email '%s'", q.Values.RawEmail)
+		}
+
+		// Respond with a compressed body to check it is decompressed.
+		var b bytes.Buffer
+		g := gzip.NewWriter(&b)
+		json.NewEncoder(g).Encode(&swanop.Operation{
+			URL:         "https://node.example/op",
+			SWIDCreated: true})
+		g.Close()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(b.Bytes())
+	})
+	q := &swanop.UpdateRequest{}
+	q.ReturnURL = "https://pub.example/"
+	q.Values.RawEmail = "user@example.com"
+	o, err := c.Update(context.Background(), "192.0.2.1", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.URL != "https://node.example/op" || o.SWIDCreated == false {
+		t.Fatalf("unexpected operation %+v", o)
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		checkRequest(t, r, "/swan/api/v2/decrypt")
+		var q swanop.DecryptRequest
+		err := json.NewDecoder(r.Body).Decode(&q)
+		if err != nil {
+			t.Error(err)
+		}
+		if q.Encrypted != "abc" {
+			t.Errorf("unexpected encrypted '%s'", q.Encrypted)
+		}
+		sendTestJSON(t, w, []*swan.Pair{
+			{Key: "pref", Value: "on"},
+			{Key: "stop", Value: "a.example"}})
+	})
+	p, err := c.Decrypt(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 2 || p[0].Key != "pref" || p[1].Value != "a.example" {
+		t.Fatalf("unexpected pairs %+v", p)
+	}
+}
+
+func TestProblemError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"about:blank","title":"Bad Request",` +
+			`"status":400,"code":"INVALID_RETURN_URL",` +
+			`"detail":"returnUrl invalid"}`))
+	})
+	_, err := c.Fetch(context.Background(), "", &swanop.FetchRequest{})
+	var e *Error
+	if errors.As(err, &e) == false {
+		t.Fatalf("expected client error but got %v", err)
+	}
+	if e.StatusCode != http.StatusBadRequest ||
+		e.Code != swanop.ErrorCodeInvalidReturnURL ||
+		e.Detail != "returnUrl invalid" {
+		t.Fatalf("unexpected error %+v", e)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	n := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		n++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	c.MaxRetries = 3
+
+	// Fetch has no effect if repeated so is retried.
+	_, err := c.Fetch(context.Background(), "", &swanop.FetchRequest{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 fetch requests but got %d", n)
+	}
+
+	// Decrypt might be single use so is not retried.
+	n = 0
+	_, err = c.Decrypt(context.Background(), "abc")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 decrypt request but got %d", n)
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	n := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sendTestJSON(t, w, &swanop.Operation{URL: "https://node.example/op"})
+	})
+	o, err := c.Fetch(context.Background(), "", &swanop.FetchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || o.URL != "https://node.example/op" {
+		t.Fatalf("expected 3 requests but got %d", n)
+	}
+}
@@ -0,0 +1,56 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error is returned when the SWAN Operator responds with an error. Code is one
+// of the swanop.ErrorCode constants and should be used to determine the cause.
+type Error struct {
+	StatusCode int    `json:"status"` // The HTTP status code
+	Code       string `json:"code"`   // The stable error code
+	Detail     string `json:"detail"` // Optional description of the error
+}
+
+// Error returns the code and any detail as a string.
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%s (%d): %s", e.Code, e.StatusCode, e.Detail)
+	}
+	return fmt.Sprintf("%s (%d)", e.Code, e.StatusCode)
+}
+
+// newError creates an error from the response. If the response is not a
+// problem document then the body is used as the detail.
+func newError(p *http.Response, d []byte) *Error {
+	var e Error
+	if strings.HasPrefix(
+		p.Header.Get("Content-Type"),
+		"application/problem+json") {
+		json.Unmarshal(d, &e)
+	}
+	if e.Code == "" {
+		e.Detail = strings.TrimSpace(string(d))
+	}
+	e.StatusCode = p.StatusCode
+	return &e
+}
@@ -0,0 +1,176 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	swanop "github.com/SWAN-community/swan-op-go"
+	"github.com/SWAN-community/swift-go"
+)
+
+// The access node used by the operator tests.
+const testAccessNode = "access.test"
+
+// newOperatorClient returns a client for a test server running the handlers of
+// a SWAN Operator with a SWIFT network held in local storage. Requests are sent
+// to the test server with the access node as the host. The handlers are added
+// to the default mux so this must only be called once.
+func newOperatorClient(t *testing.T) *Client {
+	d := t.TempDir()
+
+	// Create the SWIFT nodes. The secrets are not used by the tests.
+	k := strings.Repeat("A", 43)
+	n := time.Now().UTC()
+	m := make(map[string]interface{})
+	addNode := func(domain string, role int) {
+		m[domain] = map[string]interface{}{
+			"network": "test",
+			"domain":  domain,
+			"created": n.Add(-time.Hour),
+			"starts":  n.Add(-time.Hour),
+			"expires": n.Add(time.Hour),
+			"role":    role,
+			"secrets": []interface{}{
+				map[string]interface{}{"key": k, "timeStamp": n}},
+			"scrambler": k}
+	}
+	addNode(testAccessNode, 0)
+	for i := 0; i < 4; i++ {
+		addNode(fmt.Sprintf("storage%d.test", i), 1)
+	}
+	writeTestJSON(t, filepath.Join(d, "swift.json"), m)
+	writeTestJSON(t, filepath.Join(d, "owid.json"), map[string]interface{}{})
+
+	// Create the settings file and the operator.
+	f := filepath.Join(d, "appsettings.json")
+	writeTestJSON(t, f, map[string]interface{}{
+		"scheme":                       "https",
+		"title":                        "Test",
+		"message":                      "Test",
+		"backgroundColor":              "white",
+		"messageColor":                 "black",
+		"progressColor":                "grey",
+		"nodeCount":                    3,
+		"storageOperationTimeout":      60,
+		"homeNodeTimeout":              60,
+		"alivePollingSeconds":          60,
+		"storageManagerRefreshMinutes": 60,
+		"maxStores":                    1,
+		"swiftFile":                    filepath.Join(d, "swift.json"),
+		"owidFile":                     filepath.Join(d, "owid.json")})
+	o, err := swanop.NewOperator(
+		f,
+		swift.NewAccessSimple([]string{testAccessKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.AddHandlers(nil)
+
+	// Direct requests for the access node to the test server.
+	s := httptest.NewServer(http.DefaultServeMux)
+	t.Cleanup(s.Close)
+	c, err := New("http://"+testAccessNode, testAccessKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HTTPClient.Transport = &http.Transport{DialContext: func(
+		ctx context.Context,
+		network string,
+		addr string) (net.Conn, error) {
+		var x net.Dialer
+		return x.DialContext(ctx, network, s.Listener.Addr().String())
+	}}
+	return c
+}
+
+// writeTestJSON writes the value v to the file as JSON.
+func writeTestJSON(t *testing.T, file string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(file, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOperator checks that the client can be used with the handlers of a SWAN
+// Operator including the validation of requests against the OpenAPI document.
+func TestOperator(t *testing.T) {
+	c := newOperatorClient(t)
+	ctx := context.Background()
+
+	// Fetch returns a storage operation that starts at the home node.
+	o, err := c.Fetch(ctx, "192.0.2.1", &swanop.FetchRequest{
+		OperationRequest: swanop.OperationRequest{
+			ReturnURL: "https://publisher.test/"},
+		Fields: []string{"pref"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.HomeNode == "" || u.Host != o.HomeNode {
+		t.Fatalf("expected URL for home node '%s' but got '%s'",
+			o.HomeNode,
+			o.URL)
+	}
+
+	// A dry run of stop reports the stopped domain.
+	v, err := c.DryRunStop(ctx, &swanop.StopRequest{
+		OperationRequest: swanop.OperationRequest{
+			ReturnURL: "https://publisher.test/"},
+		Host: "https://www.example.com/page"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Valid == false ||
+		len(v.Writes) == 0 ||
+		strings.Contains(v.Writes[0].Value, "www.example.com") == false {
+		t.Fatalf("unexpected dry run %+v", v)
+	}
+
+	// Errors are returned with the code from the operator.
+	_, err = c.Stop(ctx, "192.0.2.1", &swanop.StopRequest{
+		OperationRequest: swanop.OperationRequest{
+			ReturnURL: "https://publisher.test/"},
+		Host: "localhost"})
+	var e *Error
+	if errors.As(err, &e) == false {
+		t.Fatalf("expected client error but got %v", err)
+	}
+	if e.StatusCode != http.StatusBadRequest ||
+		e.Code != swanop.ErrorCodeInvalidDomain {
+		t.Fatalf("unexpected error %+v", e)
+	}
+}
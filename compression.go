@@ -0,0 +1,152 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings supported by the SWAN Operator.
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingDeflate  = "deflate"
+	encodingIdentity = "identity"
+)
+
+// The content codings in order of preference when the caller gives more than
+// one the same quality value.
+var encodingPreference = []string{
+	encodingBrotli,
+	encodingGzip,
+	encodingDeflate,
+	encodingIdentity}
+
+// compressor is implemented by all the pooled writers.
+type compressor interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// Pools of compressors for each of the content codings to avoid allocating a
+// new compressor for every response.
+var compressorPools = map[string]*sync.Pool{
+	encodingBrotli: {New: func() interface{} {
+		return brotli.NewWriter(nil)
+	}},
+	encodingGzip: {New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}},
+	encodingDeflate: {New: func() interface{} {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+// getEncoding returns the content coding to use for the response based on the
+// Accept-Encoding header of the request. If the header is missing then
+// identity is returned. Identity is preferred when c is false and the caller
+// accepts it, as compressing the response is not worthwhile. An empty string
+// is returned if the caller has refused identity and none of the supported
+// codings are acceptable.
+func getEncoding(r *http.Request, c bool) string {
+	h := r.Header.Get("Accept-Encoding")
+	if h == "" {
+		return encodingIdentity
+	}
+
+	// Get the quality value for each of the codings listed by the caller.
+	q := make(map[string]float64)
+	for _, v := range strings.Split(h, ",") {
+		p := strings.Split(v, ";")
+		n := strings.ToLower(strings.TrimSpace(p[0]))
+		if n == "" {
+			continue
+		}
+		w := 1.0
+		for _, a := range p[1:] {
+			a = strings.TrimSpace(a)
+			if strings.HasPrefix(a, "q=") {
+				f, err := strconv.ParseFloat(a[2:], 64)
+				if err == nil {
+					w = f
+				}
+			}
+		}
+		q[n] = w
+	}
+
+	// Get the quality value for the coding. Codings not listed use the
+	// wildcard quality value if present. Identity is always acceptable unless
+	// explicitly excluded either by name or by the wildcard.
+	getQuality := func(n string) float64 {
+		w, ok := q[n]
+		if ok == false {
+			w, ok = q["*"]
+		}
+		if ok == false && n == encodingIdentity {
+			w = 0.001
+		}
+		return w
+	}
+
+	// Use identity if compression is not worthwhile and the caller accepts
+	// it.
+	if c == false && getQuality(encodingIdentity) > 0 {
+		return encodingIdentity
+	}
+
+	// Find the supported coding with the highest quality value. Codings with
+	// a quality value of zero are not acceptable.
+	e := ""
+	b := 0.0
+	for _, n := range encodingPreference {
+		w := getQuality(n)
+		if w > b {
+			e = n
+			b = w
+		}
+	}
+	return e
+}
+
+// compress returns the byte array provided compressed with the content coding.
+// The compressor is returned to the pool when complete.
+func compress(e string, b []byte) ([]byte, error) {
+	p := compressorPools[e]
+	c := p.Get().(compressor)
+	defer p.Put(c)
+	var f bytes.Buffer
+	c.Reset(&f)
+	_, err := c.Write(b)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Close()
+	if err != nil {
+		return nil, err
+	}
+	return f.Bytes(), nil
+}
@@ -29,9 +29,55 @@ type Configuration struct {
 	Debug  bool   `json:"debug"`
 	// Seconds until the value provided should be revalidated
 	RevalidateSeconds int `json:"revalidateSeconds"`
+	// Seconds before the revalidation time, or the expiry of a value, that
+	// callers are advised to revalidate soon. Defaults to a tenth of the
+	// revalidate seconds.
+	RevalidateSoonSeconds int `json:"revalidateSoonSeconds"`
 	// The number of days after which the data will automatically be removed
 	// from SWAN and will need to be provided again by the user.
 	DeleteDays int `json:"deleteDays"`
+	// The minimum size in bytes of a response body before it is compressed.
+	// Smaller responses are sent uncompressed as the saving is negligible. Zero
+	// uses the default of 512 bytes. Set to 1 to compress every response that
+	// has a body.
+	CompressMinBytes int `json:"compressMinBytes"`
+	// The maximum number of stopped domains held for a user. The oldest
+	// domains are removed first. Decrypt only returns this many domains. The
+	// values held by the network are limited when the stopped domains are
+	// next provided with a stop, unstop or update. Zero for no limit.
+	StopMaxEntries int `json:"stopMaxEntries"`
+	// The number of days a stopped domain is held for after it was added. Zero
+	// to hold stopped domains until the stop value is removed from the
+	// network.
+	StopExpiryDays int `json:"stopExpiryDays"`
+	// The message displayed to the user when their SWAN data is erased in the
+	// default language. Equivalent to the forget message template for the
+	// default language.
+	ForgetMessage string `json:"forgetMessage"`
+	// The language used for messages when the caller does not provide one or
+	// there is no message for the language requested. Defaults to en.
+	DefaultLanguage string `json:"defaultLanguage"`
+	// Templates for the messages displayed to the user keyed on the operation
+	// and then the language.
+	Messages Messages `json:"messages"`
+	// True if return URLs must use the https scheme. Not enforced when debug
+	// is enabled.
+	ReturnURLHTTPS bool `json:"returnUrlHttps"`
+	// The secret used to bind the results of storage operations to the
+	// publisher that initiated them. Must be the same for all the processes
+	// of the operator and kept private. Results are not bound if empty.
+	// Results of storage operations started before the secret is configured,
+	// or changed, are rejected so it should be set when few operations are in
+	// progress.
+	BindingSecret string `json:"bindingSecret"`
+	// True if encrypted results can only be decrypted once. Repeat requests to
+	// decrypt the same results are rejected.
+	SingleUseResults bool `json:"singleUseResults"`
+	// The maximum number of decrypted results held in memory when results
+	// are single use. The oldest are removed first when the limit is reached.
+	NonceCacheSize int `json:"nonceCacheSize"`
+	// Settings for specific publishers keyed on their access key.
+	Publishers map[string]*Publisher `json:"publishers"`
 }
 
 // RevalidateSecondsDuration in seconds as a time.Duration
@@ -39,6 +85,11 @@ func (c *Configuration) RevalidateSecondsDuration() time.Duration {
 	return time.Duration(c.RevalidateSeconds) * time.Second
 }
 
+// RevalidateSoonSecondsDuration in seconds as a time.Duration
+func (c *Configuration) RevalidateSoonSecondsDuration() time.Duration {
+	return time.Duration(c.RevalidateSoonSeconds) * time.Second
+}
+
 // NewConfig creates a new instance of configuration from the file provided.
 func newConfig(file string) Configuration {
 	var c Configuration
@@ -54,6 +105,19 @@ func newConfig(file string) Configuration {
 	if c.DeleteDays == 0 {
 		c.DeleteDays = 90
 	}
+	if c.RevalidateSoonSeconds == 0 {
+		c.RevalidateSoonSeconds = c.RevalidateSeconds / 10
+	}
+	if c.CompressMinBytes == 0 {
+		c.CompressMinBytes = 512
+	}
+	if c.NonceCacheSize == 0 {
+		c.NonceCacheSize = 100000
+	}
+	if c.DefaultLanguage == "" {
+		c.DefaultLanguage = defaultLanguage
+	}
+	c.setDefaultMessages()
 	return c
 }
 
@@ -61,5 +125,10 @@ func newConfig(file string) Configuration {
 // date will be removed from the network. Users will have to re-enter the data
 // after this time.
 func (c *Configuration) DeleteDate() time.Time {
-	return time.Now().UTC().AddDate(0, 0, c.DeleteDays)
+	return getDeleteDate(c.DeleteDays)
+}
+
+// getDeleteDate returns the date d days from now in UTC.
+func getDeleteDate(d int) time.Time {
+	return time.Now().UTC().AddDate(0, 0, d)
 }
@@ -0,0 +1,198 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DryRun is returned by the update and stop handlers when a dry run is
+// requested. Every value provided is validated and the values that would be
+// written are reported without creating a storage operation or a new SWID.
+type DryRun struct {
+	// True if there were no errors and the storage operation can be created.
+	Valid bool `json:"valid"`
+	// The values that would be written by the storage operation.
+	Writes []*DryRunWrite `json:"writes"`
+	// The values that failed validation.
+	Errors []*DryRunError `json:"errors"`
+	// The first error added. Returned by operations that stop at the first
+	// value that fails validation.
+	err error
+}
+
+// DryRunWrite is a value that would be written by the storage operation.
+type DryRunWrite struct {
+	Key string `json:"key"`
+	// The SWIFT conflict rule. > the newest value is used, < the oldest value
+	// is used, and + the value is added to the existing values.
+	Conflict string `json:"conflict"`
+	// The date the value will be removed from the network.
+	Expires time.Time `json:"expires"`
+	// The value to be written. Empty if a new SWID would be created. Raw
+	// values are reported as the OWID signed by the SWAN Operator.
+	Value string `json:"value,omitempty"`
+	// True if a new SWID would be created by the storage operation.
+	SWIDCreated bool `json:"swidCreated,omitempty"`
+	// True if the existing value would be deleted.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// DryRunError is a value that failed validation.
+type DryRunError struct {
+	Key    string `json:"key"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// addWrite adds a value that would be written with the conflict rule c and
+// removed from the network after t.
+func (d *DryRun) addWrite(k string, c string, t time.Time, v string) {
+	d.Writes = append(d.Writes, &DryRunWrite{
+		Key:      k,
+		Conflict: c,
+		Expires:  t,
+		Value:    v})
+}
+
+// addStopWrites adds the stopped domains value v that would be written to the
+// stop list key, and the domains it contains to the stop key, with the
+// conflict rule c and removed from the network after t.
+func (d *DryRun) addStopWrites(c string, t time.Time, v string) {
+	d.addWrite(stopListKey, c, t, v)
+	d.addWrite("stop", c, t, getLegacyStops(v))
+}
+
+// addError adds the error for the key using the code unless the error already
+// carries one.
+func (d *DryRun) addError(k string, err error, code string) {
+	d.Errors = append(d.Errors, &DryRunError{
+		Key:    k,
+		Code:   getErrorCode(err, code),
+		Detail: err.Error()})
+	d.Valid = false
+	if d.err == nil {
+		d.err = newError(getErrorCode(err, code), err)
+	}
+}
+
+// hasKey returns true if a value would be written for the key k, or the value
+// for the key failed validation.
+func (d *DryRun) hasKey(k string) bool {
+	for _, i := range d.Writes {
+		if i.Key == k {
+			return true
+		}
+	}
+	for _, i := range d.Errors {
+		if i.Key == k {
+			return true
+		}
+	}
+	return false
+}
+
+// newDryRun returns an empty valid dry run report.
+func newDryRun() *DryRun {
+	return &DryRun{
+		Valid:  true,
+		Writes: make([]*DryRunWrite, 0),
+		Errors: make([]*DryRunError, 0)}
+}
+
+// checkUpdate validates all the values in the request form that would be
+// written by update. Values are retained for d days. Raw values are signed in
+// the same way as update so that the OWIDs that would be written are reported
+// and a missing OWID creator is found.
+func checkUpdate(s *services, r *http.Request, d int) *DryRun {
+	v := newDryRun()
+	checkReturnURL(s, r, messageUpdate, v)
+	addUpdateWrites(s, r, d, v)
+
+	// A new SWID would be created if none is provided which needs an OWID
+	// creator.
+	if v.hasKey("swid") == false {
+		_, err := getCreator(s, r)
+		if err != nil {
+			v.addError("swid", err, ErrorCodeNoCreator)
+		} else {
+			v.addWrite("swid", "<", getDeleteDay(d), "")
+			v.Writes[len(v.Writes)-1].SWIDCreated = true
+		}
+	}
+	return v
+}
+
+// checkStop validates the values in the request form that would be written by
+// stop. Values are retained for d days.
+func checkStop(s *services, r *http.Request, d int) *DryRun {
+	v := newDryRun()
+	checkReturnURL(s, r, messageStop, v)
+	t := getDeleteDay(d)
+	if r.Form.Get("host") == "" {
+		v.addError(
+			"host",
+			fmt.Errorf("'host' must be provided"),
+			ErrorCodeMissingParameter)
+	} else {
+		r.Form.Set("stop", r.Form.Get("host"))
+		c, i, err := getStopValue(&s.config, r)
+		if err != nil {
+			v.addError("host", err, ErrorCodeInvalidDomain)
+		} else {
+			v.addStopWrites(c, t, i)
+		}
+	}
+	return v
+}
+
+// checkReturnURL adds an error to the dry run if the user interface profile
+// for the operation o does not exist or the return URL is not valid.
+func checkReturnURL(s *services, r *http.Request, o string, v *DryRun) {
+	err := setProfile(s, r, o)
+	if err != nil {
+		v.addError("profile", err, ErrorCodeInvalidRequest)
+	}
+	err = setReturnURL(s, r)
+	if err != nil {
+		v.addError("returnUrl", err, ErrorCodeInvalidReturnURL)
+	}
+}
+
+// getDeleteDay returns the date d days from now without a time as used in the
+// SWIFT keys.
+func getDeleteDay(d int) time.Time {
+	t := getDeleteDate(d)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// sendDryRun responds with the dry run report as JSON.
+func sendDryRun(
+	s *services,
+	w http.ResponseWriter,
+	r *http.Request,
+	v *DryRun) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		returnServerError(&s.config, w, err)
+		return
+	}
+	sendJSON(s, w, r, j)
+}
@@ -0,0 +1,142 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Stable error codes returned in the code member of a SWAN API error response.
+// Callers should use these values, rather than the detail message, to decide
+// how to handle an error.
+const (
+	// The access key is missing or not valid.
+	ErrorCodeAccessDenied = "ACCESS_DENIED"
+	// A header usually sent by web browsers was present in the request.
+	ErrorCodeBrowserHeaderPresent = "BROWSER_HEADER_PRESENT"
+	// The host is not a SWAN access node known to this operator.
+	ErrorCodeInvalidAccessNode = "INVALID_ACCESS_NODE"
+	// The request parameters or body could not be parsed.
+	ErrorCodeInvalidRequest = "INVALID_REQUEST"
+	// The HTTP method is not supported by the end point.
+	ErrorCodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	// The return URL is missing or not valid.
+	ErrorCodeInvalidReturnURL = "INVALID_RETURN_URL"
+	// A required parameter other than encrypted was not provided.
+	ErrorCodeMissingParameter = "MISSING_PARAMETER"
+	// An OWID provided could not be decoded or failed verification.
+	ErrorCodeInvalidOWID = "INVALID_OWID"
+	// The storage operation could not be created from the values provided.
+	ErrorCodeInvalidOperation = "INVALID_OPERATION"
+	// The encrypted parameter was not provided.
+	ErrorCodeMissingEncrypted = "MISSING_ENCRYPTED"
+	// The encrypted parameter could not be decoded or decrypted.
+	ErrorCodeInvalidEncrypted = "INVALID_ENCRYPTED"
+	// The encrypted data has expired and can no longer be used.
+	ErrorCodeDataExpired = "DATA_EXPIRED"
+	// The data contained in the encrypted parameter is not valid.
+	ErrorCodeInvalidData = "INVALID_DATA"
+	// The encrypted results were initiated with a different access key.
+	ErrorCodeNotInitiator = "NOT_INITIATOR"
+	// The encrypted results are single use and have already been decrypted.
+	ErrorCodeAlreadyDecrypted = "ALREADY_DECRYPTED"
+	// A domain for the stopped domains is not a valid registrable domain.
+	ErrorCodeInvalidDomain = "INVALID_DOMAIN"
+	// No OWID creator is registered for the SWAN Operator's domain.
+	ErrorCodeNoCreator = "NO_CREATOR"
+	// None of the content codings in the Accept-Encoding header are supported.
+	ErrorCodeNotAcceptable = "NOT_ACCEPTABLE"
+	// An unexpected error occurred in the SWAN Operator.
+	ErrorCodeInternal = "INTERNAL_ERROR"
+)
+
+// The HTTP status code associated with each of the error codes. Any code not
+// in the map is treated as an internal server error.
+var errorCodeStatus = map[string]int{
+	ErrorCodeAccessDenied:         http.StatusNetworkAuthenticationRequired,
+	ErrorCodeBrowserHeaderPresent: http.StatusNetworkAuthenticationRequired,
+	ErrorCodeInvalidAccessNode:    http.StatusBadRequest,
+	ErrorCodeInvalidRequest:       http.StatusBadRequest,
+	ErrorCodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	ErrorCodeInvalidReturnURL:     http.StatusBadRequest,
+	ErrorCodeMissingParameter:     http.StatusBadRequest,
+	ErrorCodeInvalidOWID:          http.StatusBadRequest,
+	ErrorCodeInvalidOperation:     http.StatusBadRequest,
+	ErrorCodeMissingEncrypted:     http.StatusBadRequest,
+	ErrorCodeInvalidEncrypted:     http.StatusBadRequest,
+	ErrorCodeDataExpired:          http.StatusBadRequest,
+	ErrorCodeInvalidData:          http.StatusBadRequest,
+	ErrorCodeNotInitiator:         http.StatusForbidden,
+	ErrorCodeAlreadyDecrypted:     http.StatusConflict,
+	ErrorCodeInvalidDomain:        http.StatusBadRequest,
+	ErrorCodeNoCreator:            http.StatusInternalServerError,
+	ErrorCodeNotAcceptable:        http.StatusNotAcceptable,
+	ErrorCodeInternal:             http.StatusInternalServerError,
+}
+
+// Error associates one of the stable error codes with the underlying error.
+type Error struct {
+	Code string // One of the ErrorCode constants
+	Err  error  // The underlying error
+}
+
+// Error returns the message of the underlying error.
+func (e *Error) Error() string {
+	if e != nil && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Code
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// StatusCode returns the HTTP status code associated with the error code.
+func (e *Error) StatusCode() int {
+	if v, ok := errorCodeStatus[e.Code]; ok {
+		return v
+	}
+	return http.StatusInternalServerError
+}
+
+// newError returns a new error with the code provided. If err already carries a
+// code then that code is retained as it will be more specific.
+func newError(code string, err error) *Error {
+	return &Error{Code: getErrorCode(err, code), Err: err}
+}
+
+// getErrorCode returns the code of the first SWAN Error in err's chain, or the
+// code provided if there isn't one. Used so that errors created deeper in the
+// operator, for example when there is no OWID creator, retain their code.
+func getErrorCode(err error, code string) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return code
+}
+
+// problem is the application/problem+json body used for all SWAN API error
+// responses. See RFC 7807.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
@@ -7,7 +7,9 @@ require (
 	github.com/SWAN-community/salt-go v0.1.4
 	github.com/SWAN-community/swan-go v0.1.3
 	github.com/SWAN-community/swift-go v0.1.5
+	github.com/andybalholm/brotli v1.0.4
 	github.com/google/uuid v1.3.0
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
 )
 
 require (
@@ -47,7 +49,6 @@ require (
 	golang.org/x/crypto v0.0.0-20201002170205-7f63de1d35b0 // indirect
 	golang.org/x/lint v0.0.0-20210508222113-6edffad5e616 // indirect
 	golang.org/x/mod v0.4.2 // indirect
-	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4 // indirect
 	golang.org/x/oauth2 v0.0.0-20210402161424-2e8d93401602 // indirect
 	golang.org/x/sys v0.0.0-20210510120138-977fb7262007 // indirect
 	golang.org/x/text v0.3.5 // indirect
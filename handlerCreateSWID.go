@@ -31,16 +31,18 @@ func handlerCreateSWID(s *services) http.HandlerFunc {
 		// Create the SWID OWID for this SWAN Operator.
 		c, err := createSWID(s, r)
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+			returnServerError(&s.config, w, err)
+			return
 		}
 
 		// Get the OWID as a byte array.
 		b, err := c.AsByteArray()
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+			returnServerError(&s.config, w, err)
+			return
 		}
 
 		// Return the SWID OWID as a byte array.
-		sendResponse(s, w, "application/octet-stream", b)
+		sendResponse(s, w, r, "application/octet-stream", b)
 	}
 }
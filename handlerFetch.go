@@ -19,46 +19,43 @@ package swanop
 import (
 	"fmt"
 	"github.com/SWAN-community/owid-go"
-	"github.com/SWAN-community/swift-go"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// The SWAN fields that can be fetched from the network.
+var fetchFields = []string{"swid", "pref", "email", "salt", "stop"}
+
 // handlerFetch returns a URL that can be used in the browser primary navigation
 // to retrieve the most current data from the SWAN network. If no data is
 // available default values are returned.
 func handlerFetch(s *services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var err error
 
 		// Check caller is authorized to access SWAN.
 		if s.getAccessAllowed(w, r) == false {
 			return
 		}
 
-		// Write out the input to the log if in debug mode.
-		if s.config.Debug {
-			log.Println(r.URL.String() + "?" + r.Form.Encode())
-		}
-
-		// Validate and set the return URL.
-		err = swift.SetURL("returnUrl", "returnUrl", &r.Form)
+		// Get the format for the response.
+		f, err := getFormat(r)
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusBadRequest)
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
 			return
 		}
 
-		// If the request includes data that is currently held by the caller
-		// then configure the storage operation to use these values if they
-		// relate to valid OWIDs.
-		setDefaults(s, r)
+		// Write out the input to the log if in debug mode.
+		if s.config.Debug {
+			log.Println(r.URL.String() + "?" + r.Form.Encode())
+		}
 
-		// Uses the SWIFT access node associated with this internet domain
-		// to determine the URL to direct the browser to.
-		u, err := createStorageOperationURL(s.swift, r, r.Form)
+		// Create the storage operation URL using the configured retention.
+		u, err := fetch(s, r, s.config.DeleteDays)
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusBadRequest)
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
 			return
 		}
 
@@ -68,127 +65,166 @@ func handlerFetch(s *services) http.HandlerFunc {
 		}
 
 		// Return the response from the SWIFT layer.
-		sendResponse(s, w, "text/plain; charset=utf-8", []byte(u))
+		sendOperation(s, w, r, f, u, false)
 	}
 }
 
-// setDefaults sets the values for the storage operation in SWIFT if there are
-// no values in the network. SWID, preference OWIDs, and stop identifiers can be
-// provided by the caller for this situation. If no SWID is provided then SWAN
-// will assign a new random one.
-func setDefaults(s *services, r *http.Request) {
-	t := s.config.DeleteDate()
-	q := &r.Form
+// fetch returns a storage operation URL to retrieve the most current data from
+// the SWAN network using the values in the request form. Values written to the
+// network as defaults are retained for d days. Shared by all versions of the
+// API.
+func fetch(s *services, r *http.Request, d int) (string, error) {
 
-	// Process any exist SWID, preference or stop data provided by the caller.
-	setSWID(s, r, t)
-	setPerf(s, r, t)
-	setStop(s, r, t)
+	// Apply the user interface profile and then validate and set the return
+	// URL.
+	err := setProfile(s, r, messageFetch)
+	if err != nil {
+		return "", err
+	}
+	err = setReturnURL(s, r)
+	if err != nil {
+		return "", err
+	}
 
-	// Get the email address either to return as the raw value, or to turn into
-	// a SID once it's been fetched. Always favour the most recent email address
-	// available across the network.
-	q.Set("email>", "")
-	q.Set("salt>", "")
+	// If the request includes data that is currently held by the caller
+	// then configure the storage operation to use these values if they
+	// relate to valid OWIDs.
+	f, err := getFields(&r.Form)
+	if err != nil {
+		return "", err
+	}
+	setDefaults(s, r, d, f)
 
-	// Delete any common parameters that might have been included in the request
-	// that we do not need. Avoids SWIFT trying to process then as keys.
-	q.Del("sid")
-	q.Del("val")
-}
+	// Set the message for the language requested.
+	err = setMessage(s, r, messageFetch, getReturnHost(r))
+	if err != nil {
+		return "", err
+	}
 
-// setStop uses the values provided and will add them to any other stop values
-// already contained in the network.
-func setStop(s *services, r *http.Request, t time.Time) {
-	if r.Form.Get("stop") != "" {
-		r.Form.Set(
-			fmt.Sprintf("stop+%s", t.Format("2006-01-02")),
-			r.Form.Get("stop"))
-	} else {
-		r.Form.Set("stop+", "")
+	// Uses the SWIFT access node associated with this internet domain
+	// to determine the URL to direct the browser to.
+	u, err := createStorageOperationURL(s, r, r.Form)
+	if err != nil {
+		return "", newError(ErrorCodeInvalidOperation, err)
 	}
-	r.Form.Del("stop")
+	return u, nil
 }
 
-// setPerf gets the value of perf from the request and verifies it's a valid
-// OWID. If it is valid then use it as the default value if the SWAN network
-// does not contain a value. If it is not valid then an empty value will be
-// used to indicate that the user has not provided any preferences.
-func setPerf(s *services, r *http.Request, t time.Time) {
-	v := r.Form.Get("pref") // The value for the Perf. to use if one not found
-	o, err := owid.FromBase64(v)
-	if err != nil {
-		logNonCriticalError(s, err)
-		v = ""
-	} else {
+// setDefaults sets the values for the storage operation in SWIFT if there are
+// no values in the network. SWID, preference, email and salt OWIDs, and stop
+// identifiers can be provided by the caller for this situation. If no SWID is
+// provided then SWAN will assign a new random one. Only the fields f are
+// included in the storage operation.
+func setDefaults(s *services, r *http.Request, d int, f map[string]bool) {
+	t := getDeleteDate(d)
+	q := &r.Form
 
-		// There is a valid OWID for the Perf. Does it meet the rules?
-		b, err := o.Verify(s.config.Scheme)
-		if err != nil {
-			logNonCriticalError(s, err)
-			v = ""
-		} else if b {
+	// Process any exist SWID, preference, email, salt or stop data provided by
+	// the caller. The email and salt are used either to return as the raw
+	// value, or to turn into a SID once they have been fetched. If the caller
+	// does not hold them then the most recent values available across the
+	// network are used.
+	if f["swid"] {
+		setOWID(s, r, "swid", t, d)
+	}
+	if f["pref"] {
+		setOWID(s, r, "pref", t, d)
+	}
+	if f["stop"] {
+		setStop(s, r, t)
+	}
+	if f["email"] {
+		setOWID(s, r, "email", t, d)
+	}
+	if f["salt"] {
+		setOWID(s, r, "salt", t, d)
+	}
 
-			// Change the expiry time to be based on the Perf. creation date.
-			t = o.Date.AddDate(0, 0, s.config.DeleteDays)
+	// Delete any common parameters that might have been included in the request
+	// that we do not need, including the defaults for any fields that were not
+	// requested. Avoids SWIFT trying to process then as keys.
+	q.Del("swid")
+	q.Del("pref")
+	q.Del("email")
+	q.Del("salt")
+	q.Del("stop")
+	q.Del("sid")
+	q.Del("val")
+}
 
-			// If the value has already expired then don't use it. If not then
-			// use it as the value if the network does not currently contain a
-			// value.
-			if time.Now().UTC().After(t) {
-				v = ""
-			}
-		} else {
-			v = ""
+// getFields returns the fields to fetch from the comma separated fields
+// parameter, removing it from the form. sid can be used to request the email
+// and salt needed to create the SID. If no fields are provided then all the
+// fields are returned. An error is returned if a field is not recognised.
+func getFields(q *url.Values) (map[string]bool, error) {
+	v := q.Get("fields")
+	q.Del("fields")
+	f := make(map[string]bool)
+	if v == "" {
+		for _, k := range fetchFields {
+			f[k] = true
 		}
+		return f, nil
 	}
+	for _, k := range strings.Split(v, ",") {
+		k = strings.TrimSpace(k)
+		switch k {
+		case "swid", "pref", "email", "salt", "stop":
+			f[k] = true
+		case "sid":
+			f["email"] = true
+			f["salt"] = true
+		default:
+			return nil, newError(ErrorCodeInvalidRequest, fmt.Errorf(
+				"field '%s' must be one of %s or sid",
+				k,
+				strings.Join(fetchFields, ", ")))
+		}
+	}
+	return f, nil
+}
 
-	// Set the value in the SWIFT storage operation, and remove the perf from
-	// the form.
-	if v != "" {
-
-		// There is an existing preference stored by the caller. Use this value
-		// if the network does not currently contain a more recent version.
-		r.Form.Set(fmt.Sprintf("pref>%s", t.Format("2006-01-02")), v)
-
+// setStop uses the values provided and will add them to any other stop values
+// already contained in the network. Any expired or excess entries are pruned
+// from the values provided. Entries that are not valid domains are dropped.
+func setStop(s *services, r *http.Request, t time.Time) {
+	e := s.config.pruneStops(parseStopped(r.Form["stop"]))
+	if len(e) > 0 {
+		setStopValue(r, "+", t.Format("2006-01-02"), formatStops(e))
 	} else {
-
-		// There is no existing preference available. Therefore retrieve the
-		// newest value contained in the network.
-		r.Form.Set("pref>", "")
+		r.Form.Set("stop+", "")
+		r.Form.Set(stopListKey+"+", "")
 	}
-
-	// Remove pref key as this is not valid for a SWIFT operation.
-	r.Form.Del("pref")
+	r.Form.Del("stop")
 }
 
-// setSWID gets the value of the SWID from the form associated with the request.
-// If that SWID is a valid OWID, can be verified with the creators public key,
-// and is SWAN access node that is known to this access node, and is finally
-// still valid when checked against the delete date, then use this value in
-// cases where the SWID does not exist in the SWAN network. This might be
-// because the SWAN Operators nodes have had cookies removed due to tracking
-// prevention methods, but the value that the caller has is still valid and can
-// be used by the SWAN Operators.
-// If none of the conditions are valid then a new SWID is created and used if
-// the SWAN network does not contain any other values.
-func setSWID(s *services, r *http.Request, t time.Time) {
-	v := r.Form.Get("swid") // The value for the SWID to use if one not found
+// setOWID gets the value of the key from the request and verifies it's a valid
+// OWID. The SWID, email and salt must also have been created by a SWAN access
+// node known to this access node. Preferences can be created by any party. If
+// it is valid then use it as the default value if the SWAN network does not
+// contain a value. This might be because the SWAN Operators nodes have had
+// cookies removed due to tracking prevention methods, but the value that the
+// caller has is still valid and can be used by the SWAN Operators. If it is not
+// valid then an empty value will be used to indicate that the caller does not
+// hold a value. Used for the SWID, preferences, email and salt which are all
+// held by the caller as OWIDs.
+func setOWID(s *services, r *http.Request, k string, t time.Time, d int) {
+	v := r.Form.Get(k) // The value for the key to use if one not found
 	o, err := owid.FromBase64(v)
 	if err != nil {
 		logNonCriticalError(s, err)
 		v = ""
 	} else {
 
-		// There is a valid OWID for the SWID. Does it meet the rules?
+		// There is a valid OWID for the key. Does it meet the rules?
 		b, err := o.Verify(s.config.Scheme)
 		if err != nil {
 			logNonCriticalError(s, err)
 			v = ""
-		} else if b && isSWAN(s, o) {
+		} else if b && (k == "pref" || isSWAN(s, o)) {
 
-			// Change the expiry time to be based on the SWID creation date.
-			t = o.Date.AddDate(0, 0, s.config.DeleteDays)
+			// Change the expiry time to be based on the OWID creation date.
+			t = o.Date.AddDate(0, 0, d)
 
 			// If the value has already expired then don't use it. If not then
 			// use it as the value if the network does not currently contain a
@@ -201,23 +237,23 @@ func setSWID(s *services, r *http.Request, t time.Time) {
 		}
 	}
 
-	// Set the value in the SWIFT storage operation, and remove the SWID from
+	// Set the value in the SWIFT storage operation, and remove the key from
 	// the form.
 	if v != "" {
 
-		// There is an existing SWID stored by the caller. Use this value if the
-		// network does not currently contain a more recent version.
-		r.Form.Set(fmt.Sprintf("swid>%s", t.Format("2006-01-02")), v)
+		// There is an existing value stored by the caller. Use this value if
+		// the network does not currently contain a more recent version.
+		r.Form.Set(fmt.Sprintf("%s>%s", k, t.Format("2006-01-02")), v)
 
 	} else {
 
-		// There is no existing SWID available. Therefore retrieve the newest
+		// There is no existing value available. Therefore retrieve the newest
 		// value contained in the network.
-		r.Form.Set("swid>", "")
+		r.Form.Set(k+">", "")
 	}
 
-	// Remove swid key as this is not valid for a SWIFT operation.
-	r.Form.Del("swid")
+	// Remove the key as this is not valid for a SWIFT operation.
+	r.Form.Del(k)
 }
 
 // isSWAN returns true if the OWID was created from an access node known to this
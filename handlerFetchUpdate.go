@@ -0,0 +1,111 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"log"
+	"net/http"
+)
+
+// handlerFetchUpdate returns a URL that can be used in the browser primary
+// navigation to both update the SWAN network with the values provided in the
+// form parameters and retrieve the most current data for all the other fields
+// in the same storage operation. Avoids the need to chain a fetch and an update
+// when the user has changed some values in the caller's own user interface.
+func handlerFetchUpdate(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check caller is authorized to access SWAN.
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the format for the response.
+		f, err := getFormat(r)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Create the storage operation URL using the configured retention.
+		u, err := fetchUpdate(s, r, s.config.DeleteDays)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Write out the URL to the log if in debug mode.
+		if s.config.Debug {
+			log.Println(u)
+		}
+
+		// Return the URL from the SWIFT layer.
+		sendOperation(s, w, r, f, u, false)
+	}
+}
+
+// fetchUpdate returns a storage operation URL that writes the values in the
+// request form to the SWAN network and reads the current values for all the
+// fields that are not being written. Values are retained for d days. Shared by
+// all versions of the API.
+func fetchUpdate(s *services, r *http.Request, d int) (string, error) {
+
+	// As values are being written do not use the home node alone.
+	r.Form.Set("useHomeNode", "false")
+
+	// Apply the user interface profile and then validate and set the return
+	// URL.
+	err := setProfile(s, r, messageFetchUpdate)
+	if err != nil {
+		return "", err
+	}
+	err = setReturnURL(s, r)
+	if err != nil {
+		return "", err
+	}
+
+	// Validate that the SWAN values provided are valid OWIDs and then set
+	// the values.
+	k, err := setValues(s, r, d)
+	if err != nil {
+		return "", err
+	}
+
+	// Read the newest values from the network for the fields that are not
+	// being written. If no SWID exists in the network then one will be created
+	// when the results are decrypted.
+	f := make(map[string]bool)
+	for _, i := range fetchFields {
+		f[i] = k[i] == false
+	}
+	r.Form.Del("fields")
+	setDefaults(s, r, d, f)
+
+	// Set the message for the language requested.
+	err = setMessage(s, r, messageFetchUpdate, getReturnHost(r))
+	if err != nil {
+		return "", err
+	}
+
+	// Uses the SWIFT access node associated with this internet domain
+	// to determine the URL to direct the browser to.
+	u, err := createStorageOperationURL(s, r, r.Form)
+	if err != nil {
+		return "", newError(ErrorCodeInvalidOperation, err)
+	}
+	return u, nil
+}
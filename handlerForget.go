@@ -0,0 +1,131 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// The SWAN keys that are erased by forget.
+var forgetKeys = []string{"swid", "pref", "email", "salt", "stop"}
+
+// handlerForget returns a URL that can be used in the browser primary
+// navigation to erase all the user's SWAN data from the network. If the
+// newSWID parameter is true then a new SWID is written in place of the
+// existing one.
+func handlerForget(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check caller is authorized to access SWAN.
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the format for the response.
+		f, err := getFormat(r)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Create the storage operation URL using the configured retention.
+		u, c, err := forget(s, r, s.config.DeleteDays)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL in the format requested.
+		sendOperation(s, w, r, f, u, c)
+	}
+}
+
+// forget returns a storage operation URL that replaces all the user's SWAN
+// data with empty values. The empty values are retained for d days so that
+// they take precedence over any older values that remain on nodes not
+// consulted. True is returned if a new SWID was created for the operation.
+// Shared by all versions of the API.
+func forget(s *services, r *http.Request, d int) (string, bool, error) {
+
+	// Get whether a new SWID should be created.
+	n, err := getBool(r, "newSWID")
+	if err != nil {
+		return "", false, err
+	}
+
+	// As this is an update operation do not use the home node alone.
+	r.Form.Set("useHomeNode", "false")
+
+	// Apply the user interface profile and then validate and set the return
+	// URL.
+	err = setProfile(s, r, messageForget)
+	if err != nil {
+		return "", false, err
+	}
+	err = setReturnURL(s, r)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Remove any values provided by the caller and then use the > sign with
+	// an empty value so that the erased value is the newest.
+	t := getDeleteDate(d).Format("2006-01-02")
+	for _, k := range forgetKeys {
+		r.Form.Del(k)
+		r.Form.Set(fmt.Sprintf("%s>%s", k, t), "")
+	}
+
+	// SWIFT merges the stopped domains held by nodes not visited by this
+	// operation when a domain is next stopped. Write an empty snapshot so that
+	// these are ignored.
+	r.Form.Del("unstop")
+	r.Form.Del("stopped")
+	setStopValue(r, ">", t, forgetStops())
+
+	// If requested replace the SWID with a new one.
+	c := false
+	if n {
+		o, err := createSWID(s, r)
+		if err != nil {
+			return "", false, newError(ErrorCodeInternal, err)
+		}
+		r.Form.Set(fmt.Sprintf("swid>%s", t), o.AsString())
+		c = true
+	}
+
+	// Use the message for the language requested unless the caller has
+	// provided one.
+	err = setMessage(s, r, messageForget, getReturnHost(r))
+	if err != nil {
+		return "", false, err
+	}
+
+	// Uses the SWIFT access node associated with this internet domain
+	// to determine the URL to direct the browser to.
+	u, err := createStorageOperationURL(s, r, r.Form)
+	if err != nil {
+		return "", false, newError(ErrorCodeInvalidOperation, err)
+	}
+	return u, c, nil
+}
+
+// forgetStops returns the value that erases the stopped domains.
+func forgetStops() string {
+	return formatSnapshot(time.Now().UTC(), nil)
+}
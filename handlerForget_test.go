@@ -0,0 +1,55 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestForgetStopsNotRestored checks that the stopped domains erased by forget
+// are not restored when a later operation merges the values still held by
+// nodes the forget operation did not visit.
+func TestForgetStopsNotRestored(t *testing.T) {
+	var c Configuration
+
+	// The value held by a node that the forget operation does not visit.
+	o := formatStops([]*stopEntry{
+		{domain: "a.com", added: time.Now().UTC().Add(-time.Hour)}})
+
+	// Erase the stopped domains.
+	f := forgetStops()
+
+	// A later fetch merges the values from all the nodes.
+	d := stopDomains(parseStops([]string{o, f}, time.Time{}))
+	if len(d) != 0 {
+		t.Fatalf("expected no stopped domains but got %v", d)
+	}
+
+	// A later stop adds a domain which is the only one stopped.
+	r := &http.Request{Form: url.Values{"stop": {"b.com"}}}
+	_, a, err := getStopValue(&c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d = stopDomains(parseStops([]string{a, o, f}, time.Time{}))
+	if len(d) != 1 || d[0] != "b.com" {
+		t.Fatalf("expected b.com but got %v", d)
+	}
+}
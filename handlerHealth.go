@@ -26,7 +26,7 @@ func handlerHealth(s *services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		c, err := s.swift.GetAliveNodesCount()
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+			returnServerError(&s.config, w, err)
 			return
 		}
 		b := []byte(fmt.Sprintf("%d", c))
@@ -33,11 +33,16 @@ func handlerHomeNode(s *services) http.HandlerFunc {
 		// Get the home for the requesting browser.
 		n, err := s.swift.GetHomeNode(r)
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+			returnServerError(&s.config, w, err)
 			return
 		}
 
 		// Return the response from the SWIFT layer.
-		sendResponse(s, w, "text/plain; charset=utf-8", []byte(n.Domain()))
+		sendResponse(
+			s,
+			w,
+			r,
+			"text/plain; charset=utf-8",
+			[]byte(n.Domain()))
 	}
 }
@@ -51,79 +51,29 @@ func handlerDecryptRawAsJSON(s *services) http.HandlerFunc {
 			return
 		}
 
-		// Create a map of key value pairs.
-		p := make(map[string]interface{})
-
-		// Unpack or copy the SWIFT key value pairs to the map.
-		for _, v := range o.Pairs() {
-			switch v.Key() {
-			case "swid":
-				// SWID does not get the OWID removed. It's is copied.
-				o := getOWIDFromSWIFTPair(s, v)
-				if o != nil {
-					p[v.Key()] = o.AsString()
-				}
-				break
-			case "email":
-				// Email is unpacked so that the original value can be
-				// displayed.
-				b := unpackOWID(s, v)
-				if b != nil {
-					p[v.Key()] = string(b)
-				}
-				break
-			case "salt":
-				// Salt is unpacked so that the email can be hashed. The payload
-				// of the OWID is the salt as a base 64 string originally
-				// returned from the salt-js JavaScript.
-				b := unpackOWID(s, v)
-				if b != nil && len(b) > 0 {
-					p[v.Key()] = string(b)
-				} else {
-					p[v.Key()] = ""
-				}
-			case "pref":
-				// Allow preferences are unpacked so that the original value can
-				// be displayed.
-				b := unpackOWID(s, v)
-				if b != nil {
-					p[v.Key()] = string(b)
-				}
-				break
-			}
+		// Unpack the raw SWAN data from the results.
+		p, err := getRaw(s, r, o)
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
 		}
 
-		// If there is no valid SWID create a new one.
-		if p["swid"] == nil {
-			o, err := createSWID(s, r)
-			if err != nil {
-				returnAPIError(
-					&s.config,
-					w,
-					err,
-					http.StatusInternalServerError)
-				return
-			}
-			p["swid"] = o.AsString()
+		// Record the results as used now that they have been processed.
+		err = useResults(s, r.Form.Get("encrypted"))
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeAlreadyDecrypted)
+			return
 		}
 
-		// Set the values needed by the UIP to continue the operation.
-		p["title"] = o.HTML.Title
-		p["backgroundColor"] = o.HTML.BackgroundColor
-		p["messageColor"] = o.HTML.MessageColor
-		p["progressColor"] = o.HTML.ProgressColor
-		p["message"] = o.HTML.Message
-		p["state"] = o.State()
-
 		// Turn the map of Raw SWAN data into a JSON string.
 		j, err := json.Marshal(p)
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+			returnServerError(&s.config, w, err)
 			return
 		}
 
 		// Send the JSON string.
-		sendGzipJSON(s, w, r, j)
+		sendJSON(s, w, r, j)
 	}
 }
 
@@ -141,28 +91,44 @@ func handlerDecryptAsJSON(s *services) http.HandlerFunc {
 			return
 		}
 
+		// Get whether the structured stop list should be included.
+		l, err := getBool(r, "stopList")
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
 		// Copy the key value pairs from SWIFT to SWAN. This is needed to
 		// turn the email into a SID, and to convert the stopped domains from
 		// byte arrays to a single string.
-		v, err := convertPairs(s, r, o.Map())
+		v, err := getDecrypted(s, r, o, l)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidData)
+			return
+		}
+
+		// Record the results as used now that they have been processed.
+		err = useResults(s, r.Form.Get("encrypted"))
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusBadRequest)
+			returnAPIError(&s.config, w, err, ErrorCodeAlreadyDecrypted)
 			return
 		}
 
 		// Turn the SWAN Pairs into a JSON string.
 		j, err := json.Marshal(v)
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+			returnServerError(&s.config, w, err)
 			return
 		}
 
 		// Send the JSON string.
-		sendGzipJSON(s, w, r, j)
+		sendJSON(s, w, r, j)
 	}
 }
 
 // getResults validates access, unpacks the results and validates the timestamp.
+// If there is an error then the method will be responsible for handling the
+// response.
 func getResults(
 	s *services,
 	w http.ResponseWriter,
@@ -174,63 +140,159 @@ func getResults(
 	}
 
 	// Get the SWIFT results from the request.
-	o := getSWIFTResults(s, w, r)
-	if o == nil {
-		return nil
-	}
-
-	// Validate that the timestamp has not expired.
-	if o.IsTimeStampValid() == false {
-		returnAPIError(
-			&s.config,
-			w,
-			fmt.Errorf("data expired and can no longer be used"),
-			http.StatusBadRequest)
+	o, err := decodeResults(s, r, r.Form.Get("encrypted"))
+	if err != nil {
+		returnAPIError(&s.config, w, err, ErrorCodeInvalidEncrypted)
 		return nil
 	}
 
 	return o
 }
 
-// Check that the encrypted parameter is present and if so decodes and decrypts
-// it to return the SWIFT results. If there is an error then the method will be
-// responsible for handling the response.
-func getSWIFTResults(
+// decodeResults checks that the encrypted value is present and if so decodes
+// and decrypts it to return the SWIFT results. An error is returned if the
+// value can not be decrypted or the timestamp of the results has expired.
+func decodeResults(
 	s *services,
-	w http.ResponseWriter,
-	r *http.Request) *swift.Results {
+	r *http.Request,
+	v string) (*swift.Results, error) {
 
 	// Validate that the encrypted parameter is present.
-	v := r.Form.Get("encrypted")
 	if v == "" {
-		returnAPIError(
-			&s.config,
-			w,
-			fmt.Errorf("Missing 'encrypted' parameter"),
-			http.StatusBadRequest)
-		return nil
+		return nil, newError(
+			ErrorCodeMissingEncrypted,
+			fmt.Errorf("Missing 'encrypted' parameter"))
 	}
 
 	// Decode the query string to form the byte array.
 	d, err := base64.RawURLEncoding.DecodeString(v)
 	if err != nil {
-		returnAPIError(&s.config, w, err, http.StatusBadRequest)
-		return nil
+		return nil, newError(ErrorCodeInvalidEncrypted, err)
 	}
 
 	// Decrypt the string with the access node.
 	o, err := decryptAndDecode(s.swift, r.Host, d)
 	if err != nil {
-		returnAPIError(&s.config, w, err, http.StatusBadRequest)
+		return nil, newError(ErrorCodeInvalidEncrypted, err)
+	}
+
+	// Validate that the timestamp has not expired.
+	if o.IsTimeStampValid() == false {
+		return nil, newError(
+			ErrorCodeDataExpired,
+			fmt.Errorf("data expired and can no longer be used"))
+	}
+
+	// Validate that the results were initiated by the same publisher.
+	err = s.config.checkBinding(r, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// useResults records the encrypted results v if results are single use. Must
+// only be called once the results have been processed successfully so that
+// failures can be retried. An error is returned if the results have already
+// been decrypted. The results are recorded for the storage operation timeout
+// as results can not be decrypted after this time.
+func useResults(s *services, v string) error {
+	if s.config.SingleUseResults == false || s.nonces == nil {
 		return nil
 	}
+	d, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return newError(ErrorCodeInvalidEncrypted, err)
+	}
+	h := sha256.Sum256(d)
+	e := time.Now().UTC().Add(
+		s.swift.Config().StorageOperationTimeoutDuration())
+	b, err := s.nonces.Add(base64.RawURLEncoding.EncodeToString(h[:]), e)
+	if err != nil {
+		return newError(ErrorCodeInternal, err)
+	}
+	if b == false {
+		return newError(
+			ErrorCodeAlreadyDecrypted,
+			fmt.Errorf("results have already been decrypted"))
+	}
+	return nil
+}
 
-	return o
+// getRaw returns a map of the raw SWAN data held in the results along with the
+// user interface values needed to continue the operation. If there is no valid
+// SWID in the results then a new one is created.
+func getRaw(
+	s *services,
+	r *http.Request,
+	o *swift.Results) (map[string]interface{}, error) {
+
+	// Create a map of key value pairs.
+	p := make(map[string]interface{})
+
+	// Unpack or copy the SWIFT key value pairs to the map.
+	for _, v := range o.Pairs() {
+		switch v.Key() {
+		case "swid":
+			// SWID does not get the OWID removed. It's is copied.
+			o := getOWIDFromSWIFTPair(s, v)
+			if o != nil {
+				p[v.Key()] = o.AsString()
+			}
+			break
+		case "email":
+			// Email is unpacked so that the original value can be
+			// displayed.
+			b := unpackOWID(s, v)
+			if b != nil {
+				p[v.Key()] = string(b)
+			}
+			break
+		case "salt":
+			// Salt is unpacked so that the email can be hashed. The payload
+			// of the OWID is the salt as a base 64 string originally
+			// returned from the salt-js JavaScript.
+			b := unpackOWID(s, v)
+			if b != nil && len(b) > 0 {
+				p[v.Key()] = string(b)
+			} else {
+				p[v.Key()] = ""
+			}
+		case "pref":
+			// Allow preferences are unpacked so that the original value can
+			// be displayed.
+			b := unpackOWID(s, v)
+			if b != nil {
+				p[v.Key()] = string(b)
+			}
+			break
+		}
+	}
+
+	// If there is no valid SWID create a new one.
+	if p["swid"] == nil {
+		o, err := createSWID(s, r)
+		if err != nil {
+			return nil, err
+		}
+		p["swid"] = o.AsString()
+	}
+
+	// Set the values needed by the UIP to continue the operation.
+	p["title"] = o.HTML.Title
+	p["backgroundColor"] = o.HTML.BackgroundColor
+	p["messageColor"] = o.HTML.MessageColor
+	p["progressColor"] = o.HTML.ProgressColor
+	p["message"] = o.HTML.Message
+	p["state"] = getCallerState(o.State())
+
+	return p, nil
 }
 
-// sendGzipJSON responds with the JSON payload provided. If debug is enabled
+// sendJSON responds with the JSON payload provided. If debug is enabled
 // then the response is set to the logger.
-func sendGzipJSON(
+func sendJSON(
 	s *services,
 	w http.ResponseWriter,
 	r *http.Request,
@@ -238,7 +300,7 @@ func sendGzipJSON(
 	if s.config.Debug {
 		log.Println(string(j))
 	}
-	sendResponse(s, w, "application/json", j)
+	sendResponse(s, w, r, "application/json", j)
 }
 
 // unpackOWID return the payload from the OWID value, or nil if the OWID is not
@@ -280,9 +342,10 @@ func verifyOWID(s *services, o *owid.OWID) error {
 }
 
 // verifyOWIDIfDebug confirms that the OWID byte array provided has a valid
-// signature only if debug mode is enabled.
+// signature only if debug mode is enabled. Empty values are deleted values and
+// are not verified.
 func verifyOWIDIfDebug(s *services, v []byte) error {
-	if s.config.Debug {
+	if s.config.Debug && len(v) > 0 {
 		o, err := owid.FromByteArray(v)
 		if err != nil {
 			return err
@@ -351,12 +414,17 @@ func convertPairs(
 			}
 			break
 		case "stop":
-			s, err := getStopped(v)
+			s, err := getStopped(&s.config, getStopPair(p))
 			if err != nil {
 				return nil, err
 			}
+			s.Key = "stop"
 			w = append(w, s)
 			break
+		case stopListKey:
+			// Don't do anything with the stop list as it has been used for
+			// the stop pair.
+			break
 		default:
 			w = append(w, copyValue(v))
 			break
@@ -386,16 +454,14 @@ func convertPairs(
 	return w, nil
 }
 
-// Converts the array of stopped values into a single string seperated by the
-// listSeparator.
-func getStopped(p *swift.Pair) (*swan.Pair, error) {
-	s := make([]string, 0, len(p.Values()))
-	for _, v := range p.Values() {
-		if len(v) > 0 {
-			s = append(s, string(v))
-		}
-	}
-	return newPairFromSWIFT(p, strings.Join(s, listSeparator)), nil
+// Converts the array of stopped values into a single string of domains
+// seperated by the listSeparator. The dates the domains were added are removed
+// and any expired or excess entries are pruned.
+func getStopped(c *Configuration, p *swift.Pair) (*swan.Pair, error) {
+	e := c.pruneStops(parseStops(getValues(p), p.Created()))
+	return newPairFromSWIFT(
+		p,
+		strings.Join(stopDomains(e), listSeparator)), nil
 }
 
 // copyValue turns the SWIFT pair into a SWAN pair taking the first value and
@@ -441,17 +507,10 @@ func getSID(
 func createOWID(s *services, r *http.Request, v []byte) (*owid.OWID, error) {
 
 	// Get the creator associated with this SWAN domain.
-	c, err := s.owid.GetCreator(r.Host)
+	c, err := getCreator(s, r)
 	if err != nil {
 		return nil, err
 	}
-	if c == nil {
-		return nil, fmt.Errorf(
-			"No creator for '%s'. Use http[s]://%s/owid/register to setup "+
-				"domain.",
-			r.Host,
-			r.Host)
-	}
 
 	// Create and sign the OWID.
 	o, err := c.CreateOWIDandSign(v)
@@ -462,6 +521,24 @@ func createOWID(s *services, r *http.Request, v []byte) (*owid.OWID, error) {
 	return o, nil
 }
 
+// getCreator returns the OWID creator associated with the SWAN domain of the
+// request. An error with the no creator code is returned if the domain has not
+// been registered.
+func getCreator(s *services, r *http.Request) (*owid.Creator, error) {
+	c, err := s.owid.GetCreator(r.Host)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, newError(ErrorCodeNoCreator, fmt.Errorf(
+			"No creator for '%s'. Use http[s]://%s/owid/register to setup "+
+				"domain.",
+			r.Host,
+			r.Host))
+	}
+	return c, nil
+}
+
 // Create the SID by salting the email address and creating an sha256 hashes.
 // If the email address is empty or the salt is empty then an empty byte array
 // is returned.
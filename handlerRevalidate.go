@@ -0,0 +1,175 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SWAN-community/owid-go"
+	"github.com/SWAN-community/swan-go"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Status values returned when previously decrypted SWAN pairs are revalidated.
+const (
+	// The pairs can continue to be used.
+	RevalidationValid = "valid"
+	// The pairs can be used but a fetch should be performed soon.
+	RevalidationSoon = "soon"
+	// The pairs must not be used and a fetch must be performed now.
+	RevalidationRedirect = "redirect"
+)
+
+// Revalidation is the advice returned for previously decrypted SWAN pairs.
+type Revalidation struct {
+	// One of RevalidationValid, RevalidationSoon or RevalidationRedirect.
+	Status string `json:"status"`
+	// The reason a fetch is needed. Empty if the pairs are valid.
+	Reason string `json:"reason,omitempty"`
+	// The time after which the pairs must be revalidated with the network.
+	// Not provided if the status is RevalidationRedirect.
+	RevalidateAt *time.Time `json:"revalidateAt,omitempty"`
+}
+
+// handlerRevalidate returns advice on whether SWAN pairs previously returned
+// by decrypt can still be used. The OWIDs, expiry dates and validation time of
+// the pairs are checked without the need for the web browser to visit the
+// SWAN network.
+func handlerRevalidate(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q RevalidateRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the fields that were originally fetched.
+		f, err := getRevalidateFields(q.Fields)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Get the advice and send the JSON response.
+		j, err := json.Marshal(revalidate(s, q.Pairs, f))
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
+		}
+		sendJSON(s, w, r, j)
+	}
+}
+
+// revalidate checks the pairs returned by decrypt and returns the advice for
+// the caller. A fetch is needed now if the val pair is missing or has passed,
+// any pair has expired, or any OWID can not be verified. A fetch is needed soon
+// if the val pair or any expiry date falls within the configured period. The
+// SWID is only required if it was one of the fields f originally fetched.
+func revalidate(
+	s *services,
+	p []*swan.Pair,
+	f map[string]bool) *Revalidation {
+	now := time.Now().UTC()
+
+	// Get the time the caller was told to revalidate the data.
+	var v *swan.Pair
+	for _, i := range p {
+		if i != nil && i.Key == "val" {
+			v = i
+		}
+	}
+	if v == nil {
+		return newRedirect("'val' not provided")
+	}
+	t, err := time.Parse(ValidationTimeFormat, v.Value)
+	if err != nil {
+		return newRedirect(fmt.Sprintf("'val' invalid: %s", err.Error()))
+	}
+	if now.After(t) {
+		return newRedirect("'val' has passed")
+	}
+
+	// Check that each of the pairs has not expired and that any OWIDs are
+	// valid. The SWID must be present if it was fetched.
+	e := t
+	h := false
+	for _, i := range p {
+		if i == nil || i.Key == "val" {
+			continue
+		}
+		if i.Expires.IsZero() == false {
+			if now.After(i.Expires) {
+				return newRedirect(fmt.Sprintf("'%s' has expired", i.Key))
+			}
+			if i.Expires.Before(e) {
+				e = i.Expires
+			}
+		}
+		switch i.Key {
+		case "swid", "pref", "sid":
+			if i.Value == "" {
+				if i.Key == "swid" {
+					return newRedirect("'swid' empty")
+				}
+				continue
+			}
+			o, err := owid.FromBase64(i.Value)
+			if err != nil {
+				return newRedirect(fmt.Sprintf("'%s' not an OWID", i.Key))
+			}
+			err = verifyOWID(s, o)
+			if err != nil {
+				logNonCriticalError(s, err)
+				return newRedirect(fmt.Sprintf("'%s' not verified", i.Key))
+			}
+			if i.Key == "swid" {
+				h = true
+			}
+		}
+	}
+	if f["swid"] && h == false {
+		return newRedirect("'swid' not provided")
+	}
+
+	// The pairs can be used. Advise a fetch soon if the earliest of the
+	// validation time and the expiry dates is close.
+	if now.Add(s.config.RevalidateSoonSecondsDuration()).After(e) {
+		return &Revalidation{
+			Status:       RevalidationSoon,
+			Reason:       "revalidation due",
+			RevalidateAt: &e}
+	}
+	return &Revalidation{Status: RevalidationValid, RevalidateAt: &e}
+}
+
+// getRevalidateFields returns the fields that were fetched using the same
+// values as the fields option of fetch. All the fields are returned if none
+// are provided.
+func getRevalidateFields(v []string) (map[string]bool, error) {
+	q := url.Values{}
+	setIfPresent(q, "fields", strings.Join(v, ","))
+	return getFields(&q)
+}
+
+// newRedirect returns advice that a fetch is needed now for the reason given.
+func newRedirect(reason string) *Revalidation {
+	return &Revalidation{Status: RevalidationRedirect, Reason: reason}
+}
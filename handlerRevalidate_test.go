@@ -0,0 +1,59 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"github.com/SWAN-community/swan-go"
+	"testing"
+	"time"
+)
+
+// TestRevalidateFields checks that the SWID is only required when it was one
+// of the fields fetched.
+func TestRevalidateFields(t *testing.T) {
+	s := &services{}
+	v := time.Now().UTC().Add(time.Hour).Format(ValidationTimeFormat)
+	p := []*swan.Pair{{Key: "val", Value: v}, {Key: "pref", Value: ""}}
+
+	// The SWID was not fetched so the pairs can be used.
+	f, err := getRevalidateFields([]string{"pref"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := revalidate(s, p, f)
+	if a.Status != RevalidationValid {
+		t.Fatalf("expected '%s' but got '%s' (%s)",
+			RevalidationValid, a.Status, a.Reason)
+	}
+
+	// All the fields were fetched so the missing SWID needs a fetch.
+	f, err = getRevalidateFields(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = revalidate(s, p, f)
+	if a.Status != RevalidationRedirect {
+		t.Fatalf("expected '%s' but got '%s'",
+			RevalidationRedirect, a.Status)
+	}
+
+	// Fields that are not recognised are rejected.
+	_, err = getRevalidateFields([]string{"unknown"})
+	if err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
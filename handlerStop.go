@@ -18,7 +18,6 @@ package swanop
 
 import (
 	"fmt"
-	"github.com/SWAN-community/swift-go"
 	"net/http"
 )
 
@@ -30,43 +29,89 @@ func handlerStop(s *services) http.HandlerFunc {
 			return
 		}
 
-		// Validate the host parameter is present.
-		if r.Form.Get("host") == "" {
-			returnAPIError(
-				&s.config,
-				w,
-				fmt.Errorf("'host' must be provided"),
-				http.StatusBadRequest)
+		// Get the format for the response.
+		f, err := getFormat(r)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
 			return
 		}
 
-		// As this is an update operation do not use the home node alone.
-		r.Form.Set("useHomeNode", "false")
-
-		// Validate the set the return URL.
-		err := swift.SetURL("returnUrl", "returnUrl", &r.Form)
+		// If a dry run is requested then validate the values and respond with
+		// the report without creating a storage operation.
+		b, err := getBool(r, "dryRun")
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusBadRequest)
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+		if b {
+			sendDryRun(s, w, r, checkStop(s, r, s.config.DeleteDays))
 			return
 		}
 
-		// Create the URL with the parameters provided by the publisher.
-		t := s.config.DeleteDate().Format("2006-01-02")
-		r.Form.Set(fmt.Sprintf("stop+%s", t), r.Form.Get("host"))
-		r.Form.Set("message", fmt.Sprintf(
-			"Bye, bye %s. Thanks for telling the world.",
-			r.Form.Get("host")))
-		r.Form.Del("host")
-
-		// Uses the SWIFT access node associated with this internet domain
-		// to determine the URL to direct the browser to.
-		u, err := createStorageOperationURL(s.swift, r, r.Form)
+		// Create the storage operation URL using the configured retention.
+		u, err := stop(s, r, s.config.DeleteDays)
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusBadRequest)
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
 			return
 		}
 
-		// Return the URL as a text string.
-		sendResponse(s, w, "text/plain; charset=utf-8", []byte(u))
+		// Return the URL in the format requested.
+		sendOperation(s, w, r, f, u, false)
+	}
+}
+
+// stop returns a storage operation URL that adds the host in the request form
+// to the stopped domains for the user. If the stopped domains previously
+// returned by decrypt are provided then they are pruned and replaced. The value
+// is retained for d days. Shared by all versions of the API.
+func stop(s *services, r *http.Request, d int) (string, error) {
+
+	// Validate the host parameter is present.
+	if r.Form.Get("host") == "" {
+		return "", newError(
+			ErrorCodeMissingParameter,
+			fmt.Errorf("'host' must be provided"))
+	}
+
+	// As this is an update operation do not use the home node alone.
+	r.Form.Set("useHomeNode", "false")
+
+	// Apply the user interface profile and then validate and set the return
+	// URL.
+	err := setProfile(s, r, messageStop)
+	if err != nil {
+		return "", err
+	}
+	err = setReturnURL(s, r)
+	if err != nil {
+		return "", err
+	}
+
+	// Create the URL with the parameters provided by the publisher.
+	t := getDeleteDate(d).Format("2006-01-02")
+	h, err := normaliseStop(r.Form.Get("host"))
+	if err != nil {
+		return "", err
+	}
+	r.Form.Set("stop", h)
+	c, v, err := getStopValue(&s.config, r)
+	if err != nil {
+		return "", err
+	}
+	setStopValue(r, c, t, v)
+	r.Form.Del("host")
+
+	// Set the message for the language requested.
+	err = setMessage(s, r, messageStop, h)
+	if err != nil {
+		return "", err
+	}
+
+	// Uses the SWIFT access node associated with this internet domain
+	// to determine the URL to direct the browser to.
+	u, err := createStorageOperationURL(s, r, r.Form)
+	if err != nil {
+		return "", newError(ErrorCodeInvalidOperation, err)
 	}
+	return u, nil
 }
@@ -0,0 +1,128 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handlerUnstop returns a URL that can be used in the browser primary
+// navigation to remove one or more hosts from the user's stopped domains.
+func handlerUnstop(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check caller is authorized to access SWAN.
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the format for the response.
+		f, err := getFormat(r)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Create the storage operation URL using the configured retention.
+		u, err := unstop(s, r, s.config.DeleteDays)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL in the format requested.
+		sendOperation(s, w, r, f, u, false)
+	}
+}
+
+// unstop returns a storage operation URL that removes the hosts in the request
+// form from the user's stopped domains. SWIFT can only add values to a list so
+// the stopped domains previously returned by decrypt must be provided. The
+// list without the hosts, and with any expired or excess entries pruned, is
+// written using the newest wins rule so that it replaces the merged list held
+// in the network. The value is retained for d days. Shared by all versions of
+// the API.
+func unstop(s *services, r *http.Request, d int) (string, error) {
+
+	// Validate the host and stopped parameters are present.
+	h := getHosts(r.Form["host"])
+	if len(h) == 0 {
+		return "", newError(
+			ErrorCodeMissingParameter,
+			fmt.Errorf("'host' must be provided"))
+	}
+	if len(r.Form["stopped"]) == 0 {
+		return "", newError(
+			ErrorCodeMissingParameter,
+			fmt.Errorf("'stopped' must be provided"))
+	}
+
+	// As this is an update operation do not use the home node alone.
+	r.Form.Set("useHomeNode", "false")
+
+	// Apply the user interface profile and then validate and set the return
+	// URL.
+	err := setProfile(s, r, messageUnstop)
+	if err != nil {
+		return "", err
+	}
+	err = setReturnURL(s, r)
+	if err != nil {
+		return "", err
+	}
+
+	// Create the URL with the parameters provided by the publisher.
+	t := getDeleteDate(d).Format("2006-01-02")
+	r.Form["unstop"] = h
+	r.Form.Del("host")
+	c, v, err := getStopValue(&s.config, r)
+	if err != nil {
+		return "", err
+	}
+	setStopValue(r, c, t, v)
+
+	// Set the message for the language requested.
+	err = setMessage(s, r, messageUnstop, strings.Join(h, ", "))
+	if err != nil {
+		return "", err
+	}
+
+	// Uses the SWIFT access node associated with this internet domain
+	// to determine the URL to direct the browser to.
+	u, err := createStorageOperationURL(s, r, r.Form)
+	if err != nil {
+		return "", newError(ErrorCodeInvalidOperation, err)
+	}
+	return u, nil
+}
+
+// getHosts returns the hosts from the values provided where each value can
+// contain a comma separated list of hosts.
+func getHosts(v []string) []string {
+	h := make([]string, 0, len(v))
+	for _, i := range v {
+		for _, n := range strings.Split(i, ",") {
+			n = strings.TrimSpace(n)
+			if n != "" {
+				h = append(h, n)
+			}
+		}
+	}
+	return h
+}
@@ -23,9 +23,11 @@ import (
 	"strings"
 
 	"github.com/SWAN-community/owid-go"
-	"github.com/SWAN-community/swift-go"
 )
 
+// The SWAN keys that can be written by update as OWIDs.
+var updateKeys = []string{"swid", "pref", "email", "salt"}
+
 // handlerUpdate returns a URL that can be used in the browser primary
 // navigation to update the SWAN network data with the values provided in the
 // form parameters.
@@ -37,86 +39,203 @@ func handlerUpdate(s *services) http.HandlerFunc {
 			return
 		}
 
-		// As this is an update operation do not use the home node alone.
-		r.Form.Set("useHomeNode", "false")
+		// Get the format for the response.
+		f, err := getFormat(r)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
 
-		// Validate and set the return URL.
-		err := swift.SetURL("returnUrl", "returnUrl", &r.Form)
+		// If a dry run is requested then validate the values and respond with
+		// the report without creating a storage operation.
+		b, err := getBool(r, "dryRun")
 		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusBadRequest)
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+		if b {
+			sendDryRun(s, w, r, checkUpdate(s, r, s.config.DeleteDays))
 			return
 		}
 
-		// Get the time when the data should be deleted.
-		t := s.config.DeleteDate().Format("2006-01-02")
+		// Create the storage operation URL using the configured retention.
+		u, c, err := update(s, r, s.config.DeleteDays)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
 
-		// Validate that the SWAN values provided are valid OWIDs and then set
-		// the values. If the SWID is not provided created a new one to use if
-		// a value does not exist already.
-		if r.Form.Get("swid") != "" {
-			err = validateOWID(s, &r.Form, "swid")
-			if err != nil {
-				returnAPIError(&s.config, w, err, http.StatusBadRequest)
-				return
-			}
+		// Return the URL from the SWIFT layer.
+		sendOperation(s, w, r, f, u, c)
+	}
+}
 
-			// Use the > sign to indicate the newest value should be used.
-			r.Form.Set(fmt.Sprintf("swid>%s", t), r.Form.Get("swid"))
-			r.Form.Del("swid")
-		} else {
-			swid, err := createSWID(s, r)
-			if err != nil {
-				returnServerError(&s.config, w, err)
-				return
-			}
+// update returns a storage operation URL to update the SWAN network data with
+// the values in the request form. Values are retained for d days. True is
+// returned if a new SWID was created for the operation. Shared by all versions
+// of the API.
+func update(s *services, r *http.Request, d int) (string, bool, error) {
 
-			// Use the < sign to indicate the oldest, or existing value should
-			// be used.
-			r.Form.Set(fmt.Sprintf("swid<%s", t), swid.AsString())
-		}
-		if r.Form.Get("pref") != "" {
-			err = validateOWID(s, &r.Form, "pref")
-			if err != nil {
-				returnAPIError(&s.config, w, err, http.StatusBadRequest)
-				return
-			}
-			r.Form.Set(fmt.Sprintf("pref>%s", t), r.Form.Get("pref"))
-			r.Form.Del("pref")
-		}
-		if r.Form.Get("email") != "" {
-			err = validateOWID(s, &r.Form, "email")
-			if err != nil {
-				returnAPIError(&s.config, w, err, http.StatusBadRequest)
-				return
-			}
-			r.Form.Set(fmt.Sprintf("email>%s", t), r.Form.Get("email"))
-			r.Form.Del("email")
+	// As this is an update operation do not use the home node alone.
+	r.Form.Set("useHomeNode", "false")
+
+	// Apply the user interface profile and then validate and set the return
+	// URL.
+	err := setProfile(s, r, messageUpdate)
+	if err != nil {
+		return "", false, err
+	}
+	err = setReturnURL(s, r)
+	if err != nil {
+		return "", false, err
+	}
+
+	// Validate that the SWAN values provided are valid OWIDs and then set
+	// the values.
+	k, err := setValues(s, r, d)
+	if err != nil {
+		return "", false, err
+	}
+
+	// If the SWID is not provided create a new one to use if a value does not
+	// exist already.
+	c := false
+	if k["swid"] == false {
+		swid, err := createSWID(s, r)
+		if err != nil {
+			return "", false, newError(ErrorCodeInternal, err)
 		}
-		if r.Form.Get("salt") != "" {
-			err = validateOWID(s, &r.Form, "salt")
+
+		// Use the < sign to indicate the oldest, or existing value should
+		// be used.
+		r.Form.Set(
+			fmt.Sprintf("swid<%s", getDeleteDate(d).Format("2006-01-02")),
+			swid.AsString())
+		c = true
+	}
+
+	// Set the message for the language requested.
+	err = setMessage(s, r, messageUpdate, getReturnHost(r))
+	if err != nil {
+		return "", false, err
+	}
+
+	// Uses the SWIFT access node associated with this internet domain
+	// to determine the URL to direct the browser to.
+	u, err := createStorageOperationURL(s, r, r.Form)
+	if err != nil {
+		return "", false, newError(ErrorCodeInvalidOperation, err)
+	}
+	return u, c, nil
+}
+
+// setValues validates that the SWAN values provided in the form are valid OWIDs
+// and then sets them to be written to the network where they are retained for d
+// days. The keys of the values that will be written are returned. The first
+// value that fails validation is returned as an error.
+func setValues(s *services, r *http.Request, d int) (map[string]bool, error) {
+	v := newDryRun()
+	addUpdateWrites(s, r, d, v)
+	if v.err != nil {
+		return nil, v.err
+	}
+	k := make(map[string]bool)
+	for _, i := range v.Writes {
+		r.Form.Set(
+			fmt.Sprintf(
+				"%s%s%s",
+				i.Key,
+				i.Conflict,
+				i.Expires.Format("2006-01-02")),
+			i.Value)
+		k[i.Key] = true
+	}
+	return k, nil
+}
+
+// addUpdateWrites adds the values in the request form that will be written by
+// update to the dry run, or errors for those that fail validation, and removes
+// them from the form. Values are retained for d days. Raw values are signed by
+// the SWAN Operator. Keys marked for deletion are written with empty values.
+// Used by both update and the dry run so that the dry run reports exactly the
+// values update would write.
+func addUpdateWrites(s *services, r *http.Request, d int, v *DryRun) {
+
+	// Get the day when the data should be deleted.
+	t := getDeleteDay(d)
+
+	// Get the keys that should be deleted.
+	x, err := getDeletes(r)
+	if err != nil {
+		v.addError("delete", err, ErrorCodeInvalidRequest)
+	}
+
+	// Use the > sign to indicate the newest value should be used. An empty
+	// value will therefore replace any existing value for deleted keys.
+	for _, k := range updateKeys {
+		if x[k] {
+			v.addWrite(k, ">", t, "")
+			v.Writes[len(v.Writes)-1].Deleted = true
+		} else if i, err := getSignedRaw(s, r, k); err != nil {
+			v.addError(k, err, ErrorCodeInvalidData)
+		} else if i != "" {
+			v.addWrite(k, ">", t, i)
+		} else if r.Form.Get(k) != "" {
+			err := validateOWID(s, &r.Form, k)
 			if err != nil {
-				returnAPIError(&s.config, w, err, http.StatusBadRequest)
-				return
+				v.addError(k, err, ErrorCodeInvalidOWID)
+			} else {
+				v.addWrite(k, ">", t, r.Form.Get(k))
 			}
-			r.Form.Set(fmt.Sprintf("salt>%s", t), r.Form.Get("salt"))
-			r.Form.Del("salt")
-		}
-		if r.Form.Get("stop") != "" {
-			r.Form.Set(fmt.Sprintf("stop+%s", t), r.Form.Get("stop"))
-			r.Form.Del("stop")
 		}
+		r.Form.Del(k)
+	}
 
-		// Uses the SWIFT access node associated with this internet domain
-		// to determine the URL to direct the browser to.
-		u, err := createStorageOperationURL(s.swift, r, r.Form)
-		if err != nil {
-			returnAPIError(&s.config, w, err, http.StatusBadRequest)
-			return
-		}
+	// Add the value to write to the stopped domains if any.
+	c, i, err := getStopValue(&s.config, r)
+	if err != nil {
+		v.addError("stop", err, ErrorCodeInvalidRequest)
+	} else if c != "" {
+		v.addStopWrites(c, t, i)
+	}
+}
 
-		// Return the URL from the SWIFT layer.
-		sendResponse(s, w, "text/plain; charset=utf-8", []byte(u))
+// The SWAN keys that can be deleted by update.
+var deleteKeys = []string{"pref", "email", "salt"}
+
+// getDeletes returns the keys to delete from the comma separated delete
+// parameter, removing it from the form. sid can be used to delete the email and
+// salt. An error is returned if a key is not recognised, or if a value is also
+// provided for a key being deleted.
+func getDeletes(r *http.Request) (map[string]bool, error) {
+	v := r.Form.Get("delete")
+	r.Form.Del("delete")
+	x := make(map[string]bool)
+	if v == "" {
+		return x, nil
+	}
+	for _, k := range strings.Split(v, ",") {
+		k = strings.TrimSpace(k)
+		switch k {
+		case "pref", "email", "salt":
+			x[k] = true
+		case "sid":
+			x["email"] = true
+			x["salt"] = true
+		default:
+			return nil, newError(ErrorCodeInvalidRequest, fmt.Errorf(
+				"delete '%s' must be one of %s or sid",
+				k,
+				strings.Join(deleteKeys, ", ")))
+		}
+	}
+	for k := range x {
+		if r.Form.Get(k) != "" || r.Form.Get(rawParameters[k]) != "" {
+			return nil, newError(ErrorCodeInvalidRequest, fmt.Errorf(
+				"'%s' can not be both deleted and provided", k))
+		}
 	}
+	return x, nil
 }
 
 // validateOWID validates that the OWID is correct if the domain is not
@@ -0,0 +1,66 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// TestSetValuesMatchesDryRun checks that update writes the values reported by
+// the dry run.
+func TestSetValuesMatchesDryRun(t *testing.T) {
+	s := &services{}
+	f := func() *http.Request {
+		return &http.Request{Form: url.Values{
+			"delete":  {"pref"},
+			"stop":    {"b.com"},
+			"stopped": {"a.com"}}}
+	}
+	v := newDryRun()
+	addUpdateWrites(s, f(), 30, v)
+	if v.Valid == false || len(v.Writes) != 3 {
+		t.Fatalf("expected 3 writes but got %d", len(v.Writes))
+	}
+	r := f()
+	k, err := setValues(s, r, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range v.Writes {
+		n := fmt.Sprintf(
+			"%s%s%s",
+			i.Key,
+			i.Conflict,
+			i.Expires.Format("2006-01-02"))
+		// The stopped domains are compared without the time of the snapshot
+		// which differs between the two operations.
+		w := r.Form[n]
+		if k[i.Key] == false || len(w) != 1 ||
+			getLegacyStops(w[0]) != getLegacyStops(i.Value) {
+			t.Fatalf("expected '%s' to be written", n)
+		}
+	}
+	_, err = setValues(s, &http.Request{Form: url.Values{
+		"delete": {"pref"},
+		"pref":   {"x"}}}, 30)
+	if getErrorCode(err, "") != ErrorCodeInvalidRequest {
+		t.Fatalf("expected '%s' but got '%v'", ErrorCodeInvalidRequest, err)
+	}
+}
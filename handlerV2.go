@@ -0,0 +1,362 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// The maximum size in bytes of a v2 JSON request body.
+const maxRequestBytes = 1 << 16
+
+// The v2 handlers accept a JSON request body posted with the accessKey in the
+// query string, and always respond with JSON. They use the same logic as the
+// v1 handlers once the request has been decoded.
+
+// handlerFetchV2 returns an Operation containing the URL to retrieve the most
+// current data from the SWAN network.
+func handlerFetchV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q FetchRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the number of days to retain values for.
+		d, err := q.getRetentionDays(&s.config)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Replace the form with the values from the request so that the
+		// shared logic can be used to create the storage operation URL.
+		r.Form = q.toForm()
+		u, err := fetch(s, r, d)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL and associated metadata.
+		sendOperation(s, w, r, formatJSON, u, false)
+	}
+}
+
+// handlerUpdateV2 returns an Operation containing the URL to update the SWAN
+// network with the values provided.
+func handlerUpdateV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q UpdateRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the number of days to retain values for.
+		d, err := q.getRetentionDays(&s.config)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Replace the form with the values from the request so that the
+		// shared logic can be used to create the storage operation URL.
+		r.Form = q.toForm()
+		if q.DryRun {
+			sendDryRun(s, w, r, checkUpdate(s, r, d))
+			return
+		}
+		u, c, err := update(s, r, d)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL and associated metadata.
+		sendOperation(s, w, r, formatJSON, u, c)
+	}
+}
+
+// handlerFetchUpdateV2 returns an Operation containing the URL to update the
+// SWAN network with the values provided and retrieve the current values for all
+// the other fields.
+func handlerFetchUpdateV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q UpdateRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the number of days to retain values for.
+		d, err := q.getRetentionDays(&s.config)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Replace the form with the values from the request so that the
+		// shared logic can be used to create the storage operation URL.
+		if q.DryRun {
+			returnAPIError(
+				&s.config,
+				w,
+				fmt.Errorf("dryRun not supported for fetch-update"),
+				ErrorCodeInvalidRequest)
+			return
+		}
+		r.Form = q.toForm()
+		u, err := fetchUpdate(s, r, d)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL and associated metadata.
+		sendOperation(s, w, r, formatJSON, u, false)
+	}
+}
+
+// handlerStopV2 returns an Operation containing the URL to add the host to the
+// user's stopped domains.
+func handlerStopV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q StopRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the number of days to retain values for.
+		d, err := q.getRetentionDays(&s.config)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Replace the form with the values from the request so that the
+		// shared logic can be used to create the storage operation URL.
+		r.Form = q.toForm()
+		if q.DryRun {
+			sendDryRun(s, w, r, checkStop(s, r, d))
+			return
+		}
+		u, err := stop(s, r, d)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL and associated metadata.
+		sendOperation(s, w, r, formatJSON, u, false)
+	}
+}
+
+// handlerUnstopV2 returns an Operation containing the URL to remove the hosts
+// from the user's stopped domains.
+func handlerUnstopV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q UnstopRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the number of days to retain values for.
+		d, err := q.getRetentionDays(&s.config)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Replace the form with the values from the request so that the
+		// shared logic can be used to create the storage operation URL.
+		r.Form = q.toForm()
+		u, err := unstop(s, r, d)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL and associated metadata.
+		sendOperation(s, w, r, formatJSON, u, false)
+	}
+}
+
+// handlerForgetV2 returns an Operation containing the URL to erase all the
+// user's SWAN data.
+func handlerForgetV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q ForgetRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the number of days to retain values for.
+		d, err := q.getRetentionDays(&s.config)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Replace the form with the values from the request so that the
+		// shared logic can be used to create the storage operation URL.
+		r.Form = q.toForm()
+		u, c, err := forget(s, r, d)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidOperation)
+			return
+		}
+
+		// Return the URL and associated metadata.
+		sendOperation(s, w, r, formatJSON, u, c)
+	}
+}
+
+// handlerDecryptV2 returns the SWAN pairs for the encrypted results. See
+// handlerDecryptAsJSON.
+func handlerDecryptV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q DecryptRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the SWIFT results from the encrypted value.
+		o, err := decodeResults(s, r, q.Encrypted)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidEncrypted)
+			return
+		}
+		v, err := getDecrypted(s, r, o, q.StopList)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidData)
+			return
+		}
+
+		// Record the results as used now that they have been processed.
+		err = useResults(s, q.Encrypted)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeAlreadyDecrypted)
+			return
+		}
+
+		// Send the JSON response.
+		j, err := json.Marshal(v)
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
+		}
+		sendJSON(s, w, r, j)
+	}
+}
+
+// handlerDecryptRawV2 returns the raw SWAN data for the encrypted results. See
+// handlerDecryptRawAsJSON.
+func handlerDecryptRawV2(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q DecryptRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Get the SWIFT results from the encrypted value.
+		o, err := decodeResults(s, r, q.Encrypted)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeInvalidEncrypted)
+			return
+		}
+		p, err := getRaw(s, r, o)
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
+		}
+
+		// Record the results as used now that they have been processed.
+		err = useResults(s, q.Encrypted)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeAlreadyDecrypted)
+			return
+		}
+
+		// Send the JSON response.
+		j, err := json.Marshal(p)
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
+		}
+		sendJSON(s, w, r, j)
+	}
+}
+
+// decodeRequest checks the caller is authorized to access SWAN and then decodes
+// the JSON request body into v. Returns false if the request can not be used,
+// in which case the method will have responded to the request already.
+func decodeRequest(
+	s *services,
+	w http.ResponseWriter,
+	r *http.Request,
+	v interface{}) bool {
+
+	// Check caller is authorized to access SWAN.
+	if s.getAccessAllowed(w, r) == false {
+		return false
+	}
+
+	// Only JSON bodies that are posted are supported.
+	if r.Method != http.MethodPost {
+		returnAPIError(
+			&s.config,
+			w,
+			fmt.Errorf("method '%s' not supported, use POST", r.Method),
+			ErrorCodeMethodNotAllowed)
+		return false
+	}
+
+	// Decode the body rejecting any members that are not recognised so that
+	// mistakes in the request are not silently ignored.
+	d := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	d.DisallowUnknownFields()
+	err := d.Decode(v)
+	if err != nil {
+		returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+		return false
+	}
+
+	// Write out the input to the log if in debug mode.
+	if s.config.Debug {
+		log.Printf("%s %+v\n", r.URL.Path, v)
+	}
+
+	return true
+}
@@ -0,0 +1,181 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SWAN-community/swift-go"
+)
+
+// The access key and access node used by the test services.
+const (
+	testAccessKey  = "test-key"
+	testAccessNode = "access.test"
+)
+
+// newTestServices returns services for a SWIFT network held in local storage
+// with a single access node and several storage nodes so that different web
+// browsers have different home nodes.
+func newTestServices(t *testing.T) *services {
+	d := t.TempDir()
+
+	// Create the SWIFT nodes. The secrets are not used by the tests.
+	k := strings.Repeat("A", 43)
+	n := time.Now().UTC()
+	m := make(map[string]interface{})
+	addNode := func(domain string, role int) {
+		m[domain] = map[string]interface{}{
+			"network": "test",
+			"domain":  domain,
+			"created": n.Add(-time.Hour),
+			"starts":  n.Add(-time.Hour),
+			"expires": n.Add(time.Hour),
+			"role":    role,
+			"secrets": []interface{}{
+				map[string]interface{}{"key": k, "timeStamp": n}},
+			"scrambler": k}
+	}
+	addNode(testAccessNode, 0)
+	for i := 0; i < 8; i++ {
+		addNode(fmt.Sprintf("storage%d.test", i), 1)
+	}
+	writeTestJSON(t, filepath.Join(d, "swift.json"), m)
+	writeTestJSON(t, filepath.Join(d, "owid.json"), map[string]interface{}{})
+
+	// Create the settings file and the services.
+	f := filepath.Join(d, "appsettings.json")
+	writeTestJSON(t, f, map[string]interface{}{
+		"scheme":                       "https",
+		"title":                        "Test",
+		"message":                      "Test",
+		"backgroundColor":              "white",
+		"messageColor":                 "black",
+		"progressColor":                "grey",
+		"nodeCount":                    3,
+		"storageOperationTimeout":      60,
+		"homeNodeTimeout":              60,
+		"alivePollingSeconds":          60,
+		"storageManagerRefreshMinutes": 60,
+		"maxStores":                    1,
+		"swiftFile":                    filepath.Join(d, "swift.json"),
+		"owidFile":                     filepath.Join(d, "owid.json"),
+		"bindingSecret":                "test-secret"})
+	s, err := newServices(f, swift.NewAccessSimple([]string{testAccessKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// writeTestJSON writes the value v to the file as JSON.
+func writeTestJSON(t *testing.T, file string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(file, b, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// postTestJSON posts the value v to the handler as a v2 JSON request to the
+// test access node.
+func postTestJSON(
+	t *testing.T,
+	h http.HandlerFunc,
+	path string,
+	v interface{}) *httptest.ResponseRecorder {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(
+		http.MethodPost,
+		"https://"+testAccessNode+path+"?accessKey="+testAccessKey,
+		bytes.NewReader(b))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// TestFetchV2HomeNode checks that the IP address of the web browser provided
+// in the request body is used to determine the home node of the operation.
+func TestFetchV2HomeNode(t *testing.T) {
+	s := newTestServices(t)
+	h := make(map[string]bool)
+	for _, ip := range []string{
+		"192.0.2.1",
+		"192.0.2.2",
+		"198.51.100.7",
+		"203.0.113.12",
+		"203.0.113.200"} {
+
+		// Get the home node expected for the IP address.
+		r := &http.Request{
+			Host: testAccessNode,
+			Form: url.Values{"remoteAddr": {ip}}}
+		e, err := s.swift.GetHomeNode(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h[e.Domain()] = true
+
+		// Create the operation and check it starts at the home node.
+		q := &FetchRequest{Fields: []string{"pref"}}
+		q.ReturnURL = "https://publisher.test/return"
+		q.RemoteAddr = ip
+		w := postTestJSON(t, handlerFetchV2(s), "/swan/api/v2/fetch", q)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status %d '%s'", w.Code, w.Body.String())
+		}
+		var o Operation
+		err = json.Unmarshal(w.Body.Bytes(), &o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.HomeNode != e.Domain() {
+			t.Fatalf("expected home node '%s' for '%s' but got '%s'",
+				e.Domain(), ip, o.HomeNode)
+		}
+		u, err := url.Parse(o.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Host != e.Domain() {
+			t.Fatalf("expected URL for '%s' but got '%s'", e.Domain(), o.URL)
+		}
+	}
+
+	// The IP addresses must not all share a home node otherwise the test does
+	// not show that the IP address was used.
+	if len(h) < 2 {
+		t.Fatal("expected more than one home node")
+	}
+}
@@ -17,7 +17,7 @@
 package swanop
 
 import (
-	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"github.com/SWAN-community/owid-go"
 	"github.com/SWAN-community/swift-go"
@@ -31,13 +31,23 @@ import (
 // settingsFile path to the file that contains the configuration settings.
 // swanAccess an authorization instance used to valid requests.
 // malformedHandler if SWAN can't handle the request the handler to use instead.
+// Returns an error if the configuration settings are not valid.
 func AddHandlers(
 	settingsFile string,
 	swanAccess Access,
 	malformedHandler func(w http.ResponseWriter, r *http.Request)) error {
+	o, err := NewOperator(settingsFile, swanAccess)
+	if err != nil {
+		return err
+	}
+	o.AddHandlers(malformedHandler)
+	return nil
+}
 
-	// Create the new set of services.
-	s := newServices(settingsFile, swanAccess)
+// addHandlers adds the swift, owid and swan end points for the services.
+func addHandlers(
+	s *services,
+	malformedHandler func(w http.ResponseWriter, r *http.Request)) {
 
 	// Add the SWIFT handlers.
 	swift.AddHandlers(s.swift, malformedHandler)
@@ -46,15 +56,34 @@ func AddHandlers(
 	owid.AddHandlers(s.owid)
 
 	// Add the SWAN handlers.
-	http.HandleFunc("/swan/api/v1/fetch", handlerFetch(s))
-	http.HandleFunc("/swan/api/v1/update", handlerUpdate(s))
-	http.HandleFunc("/swan/api/v1/stop", handlerStop(s))
-	http.HandleFunc("/swan/api/v1/home-node", handlerHomeNode(s))
-	http.HandleFunc("/swan/api/v1/decrypt", handlerDecryptAsJSON(s))
-	http.HandleFunc("/swan/api/v1/decrypt-raw", handlerDecryptRawAsJSON(s))
-	http.HandleFunc("/swan/api/v1/create-swid", handlerCreateSWID(s))
+	addHandler(s, "/swan/api/v1/fetch", handlerFetch(s))
+	addHandler(s, "/swan/api/v1/update", handlerUpdate(s))
+	addHandler(s, "/swan/api/v1/fetch-update", handlerFetchUpdate(s))
+	addHandler(s, "/swan/api/v1/stop", handlerStop(s))
+	addHandler(s, "/swan/api/v1/unstop", handlerUnstop(s))
+	addHandler(s, "/swan/api/v1/forget", handlerForget(s))
+	addHandler(s, "/swan/api/v1/home-node", handlerHomeNode(s))
+	addHandler(s, "/swan/api/v1/decrypt", handlerDecryptAsJSON(s))
+	addHandler(s, "/swan/api/v1/decrypt-raw", handlerDecryptRawAsJSON(s))
+	addHandler(s, "/swan/api/v1/create-swid", handlerCreateSWID(s))
+	addHandler(s, "/swan/api/v2/fetch", handlerFetchV2(s))
+	addHandler(s, "/swan/api/v2/update", handlerUpdateV2(s))
+	addHandler(s, "/swan/api/v2/fetch-update", handlerFetchUpdateV2(s))
+	addHandler(s, "/swan/api/v2/stop", handlerStopV2(s))
+	addHandler(s, "/swan/api/v2/unstop", handlerUnstopV2(s))
+	addHandler(s, "/swan/api/v2/forget", handlerForgetV2(s))
+	addHandler(s, "/swan/api/v2/decrypt", handlerDecryptV2(s))
+	addHandler(s, "/swan/api/v2/decrypt-raw", handlerDecryptRawV2(s))
+	addHandler(s, "/swan/api/v2/revalidate", handlerRevalidate(s))
+	addHandler(s, "/swan/api/v2/evaluate-stop", handlerEvaluateStop(s))
 	http.HandleFunc("/health", handlerHealth(s))
-	return nil
+	http.HandleFunc("/swan/api/openapi.json", handlerOpenAPI(s))
+}
+
+// addHandler adds the handler for the path. Requests are validated against the
+// OpenAPI document before reaching the handler.
+func addHandler(s *services, p string, h http.HandlerFunc) {
+	http.HandleFunc(p, validate(s, h))
 }
 
 func newResponseError(c *Configuration, r *http.Response) error {
@@ -74,61 +103,80 @@ func newResponseError(c *Configuration, r *http.Response) error {
 		strings.TrimSpace(string(in)))
 }
 
+// returnAPIError responds with an application/problem+json body containing the
+// stable error code. If err already carries a code then that code is used in
+// preference to the one provided. The detail message is only included for
+// server errors when debug is enabled to avoid leaking implementation details.
 func returnAPIError(
 	c *Configuration,
 	w http.ResponseWriter,
 	err error,
-	code int) {
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	http.Error(w, err.Error(), code)
-	if c.Debug {
-		println(err.Error())
+	code string) {
+	e := newError(getErrorCode(err, code), err)
+	p := problem{
+		Type:   "about:blank",
+		Status: e.StatusCode(),
+		Code:   e.Code,
 	}
-}
-
-func returnRequestError(
-	c *Configuration,
-	w http.ResponseWriter,
-	err error,
-	code int) {
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	if c.Debug {
-		http.Error(w, err.Error(), code)
-	} else {
-		http.Error(w, "", code)
+	p.Title = http.StatusText(p.Status)
+	if p.Status < http.StatusInternalServerError || c.Debug {
+		p.Detail = err.Error()
 	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		b = []byte("{}")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(b)
 	if c.Debug {
-		println(err.Error())
+		println(e.Error())
 	}
 }
 
+// returnServerError responds with an internal server error unless err already
+// carries a more specific code.
 func returnServerError(c *Configuration, w http.ResponseWriter, err error) {
-	w.Header().Set("Cache-Control", "no-cache")
-	if c.Debug {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-	} else {
-		http.Error(w, "", http.StatusInternalServerError)
-	}
-	if c.Debug {
-		println(err.Error())
-	}
+	returnAPIError(c, w, err, ErrorCodeInternal)
 }
 
+// sendResponse writes the byte array to the response with the content type
+// provided. The body is compressed using the best content coding accepted by
+// the caller if it is at least the configured minimum size, or if the caller
+// has refused an uncompressed body. If none of the content codings are
+// acceptable then a not acceptable error is returned. The body is always
+// compressed in full before any headers are written so that a failure never
+// results in a partially compressed response.
 func sendResponse(
 	s *services,
 	w http.ResponseWriter,
+	r *http.Request,
 	t string,
 	b []byte) {
-	g := gzip.NewWriter(w)
-	defer g.Close()
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Set("Content-Type", t)
-	w.Header().Set("Cache-Control", "no-cache")
-	_, err := g.Write(b)
-	if err != nil {
-		returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+	e := getEncoding(r, len(b) >= s.config.CompressMinBytes)
+	if e == "" {
+		returnAPIError(
+			&s.config,
+			w,
+			fmt.Errorf("no acceptable content coding in '%s'",
+				r.Header.Get("Accept-Encoding")),
+			ErrorCodeNotAcceptable)
 		return
 	}
+	if e != encodingIdentity {
+		c, err := compress(e, b)
+		if err != nil {
+			logNonCriticalError(s, err)
+		} else {
+			b = c
+			w.Header().Set("Content-Encoding", e)
+		}
+	}
+	w.Header().Set("Content-Type", t)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Vary", "Accept-Encoding")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(b)))
+	w.Write(b)
 }
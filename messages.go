@@ -0,0 +1,253 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Operations that message templates can be configured for.
+const (
+	messageFetch       = "fetch"
+	messageUpdate      = "update"
+	messageFetchUpdate = "fetch-update"
+	messageStop        = "stop"
+	messageUnstop      = "unstop"
+	messageForget      = "forget"
+)
+
+// The language of the built in messages. Used when there is no message for
+// the requested or configured default language.
+const defaultLanguage = "en"
+
+// Messages contains the templates for the message displayed to the user during
+// a storage operation keyed on the operation and then the language. Templates
+// use the text/template syntax where {{.Host}} is the domain, or domains, the
+// operation relates to.
+type Messages map[string]map[string]string
+
+// messageData is the data made available to the message templates.
+type messageData struct {
+	// The domain or domains the operation relates to. For stop and unstop the
+	// domains being stopped or allowed again, otherwise the domain of the
+	// return URL.
+	Host string
+}
+
+// The built in messages used if none are configured for the operation and
+// language.
+var defaultMessages = Messages{
+	messageStop: {
+		defaultLanguage: "Bye, bye {{.Host}}. Thanks for telling the world."},
+	messageUnstop: {
+		defaultLanguage: "Welcome back {{.Host}}. " +
+			"Thanks for telling the world."},
+	messageForget: {
+		defaultLanguage: "Your SWAN data has been erased. " +
+			"Thanks for telling the world."}}
+
+// Valid language tags. The primary language subtag followed by optional
+// subtags such as the region. For example en or en-GB.
+var languagePattern = regexp.MustCompile(
+	`^[a-z]{2,8}(-[a-z0-9]{1,8})*$`)
+
+// getLanguage returns the lower case language parameter from the request,
+// removing it from the form so that it is not treated as a SWIFT key. An empty
+// string is returned if the parameter is not present. If the value is not a
+// valid language tag then an error is returned.
+func getLanguage(r *http.Request) (string, error) {
+	l := strings.ToLower(r.Form.Get("language"))
+	r.Form.Del("language")
+	if l != "" && languagePattern.MatchString(l) == false {
+		return "", newError(
+			ErrorCodeInvalidRequest,
+			fmt.Errorf("language '%s' must be a language tag like en-GB", l))
+	}
+	return l, nil
+}
+
+// getLanguages returns the languages to try in order of preference for the
+// language l. The language itself, then the primary language, then the
+// configured default language, and finally the language of the built in
+// messages.
+func (c *Configuration) getLanguages(l string) []string {
+	a := make([]string, 0, 4)
+	if l != "" {
+		a = append(a, l)
+		if i := strings.Index(l, "-"); i > 0 {
+			a = appendUnique(a, l[:i])
+		}
+	}
+	if c.DefaultLanguage != "" {
+		a = appendUnique(a, strings.ToLower(c.DefaultLanguage))
+	}
+	return appendUnique(a, defaultLanguage)
+}
+
+// getMessage returns the template for the operation o in the first language
+// in l with a template. The templates for the publisher associated with the
+// request take precedence over those configured for all publishers. An empty
+// string is returned if there is no template.
+func (c *Configuration) getMessage(
+	r *http.Request,
+	o string,
+	l []string) string {
+	p := c.getPublisher(r)
+	for _, i := range l {
+		if p != nil {
+			if t := p.Messages[o][i]; t != "" {
+				return t
+			}
+		}
+		if t := c.Messages[o][i]; t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// hasMessage returns true if there is a template for the operation o in one of
+// the languages tried for the language parameter in the request.
+func (c *Configuration) hasMessage(r *http.Request, o string) bool {
+	l := strings.ToLower(r.Form.Get("language"))
+	return c.getMessage(r, o, c.getLanguages(l)) != ""
+}
+
+// setMessage sets the message parameter for the operation o using the template
+// for the language requested. The message provided by the caller, if any, is
+// used in preference to the template. h is the domain, or domains, the
+// operation relates to.
+func setMessage(s *services, r *http.Request, o string, h string) error {
+
+	// Get the language requested for the message.
+	l, err := getLanguage(r)
+	if err != nil {
+		return err
+	}
+
+	// Use the message provided by the caller if present.
+	if r.Form.Get("message") != "" {
+		return nil
+	}
+
+	// Find the template and if one exists use it to create the message.
+	t := s.config.getMessage(r, o, s.config.getLanguages(l))
+	if t == "" {
+		return nil
+	}
+	m, err := formatMessage(t, &messageData{Host: h})
+	if err != nil {
+		return newError(ErrorCodeInternal, err)
+	}
+	r.Form.Set("message", m)
+	return nil
+}
+
+// getReturnHost returns the host of the return URL in the request form, or an
+// empty string if the return URL is not valid.
+func getReturnHost(r *http.Request) string {
+	u, err := url.Parse(r.Form.Get("returnUrl"))
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// formatMessage returns the message created from the template t and the data
+// d.
+func formatMessage(t string, d *messageData) (string, error) {
+	p, err := template.New("message").Parse(t)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	err = p.Execute(&b, d)
+	if err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// validateMessages checks that all the configured message templates,
+// including those for publishers, can be parsed and executed.
+func (c *Configuration) validateMessages() error {
+	err := validateTemplates("", c.Messages)
+	if err != nil {
+		return err
+	}
+	for _, p := range c.Publishers {
+		if p == nil {
+			continue
+		}
+		err = validateTemplates(p.describe()+" ", p.Messages)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateTemplates checks that the templates in m can be used. n is added to
+// the start of any error message to identify the source of the templates.
+func validateTemplates(n string, m Messages) error {
+	for o, t := range m {
+		for l, v := range t {
+			_, err := formatMessage(v, &messageData{})
+			if err != nil {
+				return fmt.Errorf(
+					"%smessage for '%s' in '%s' invalid: %s", n, o, l, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setDefaultMessages adds the forget message to the default language and then
+// the built in messages if templates are not already configured for them.
+func (c *Configuration) setDefaultMessages() {
+	if c.Messages == nil {
+		c.Messages = make(Messages)
+	}
+	if c.ForgetMessage != "" {
+		setDefaultMessage(
+			c.Messages,
+			messageForget,
+			strings.ToLower(c.DefaultLanguage),
+			c.ForgetMessage)
+	}
+	for o, t := range defaultMessages {
+		for l, v := range t {
+			setDefaultMessage(c.Messages, o, l, v)
+		}
+	}
+}
+
+// setDefaultMessage sets the template t for operation o and language l if no
+// template is already present.
+func setDefaultMessage(m Messages, o string, l string, t string) {
+	if m[o] == nil {
+		m[o] = make(map[string]string)
+	}
+	if m[o][l] == "" {
+		m[o][l] = t
+	}
+}
@@ -0,0 +1,78 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceMemory is an implementation of swan.NonceStore that holds a bounded
+// number of nonces in memory. When the store is full the oldest nonce is
+// removed even if it has not expired. Only suitable where all decrypt requests
+// are handled by the same process.
+type NonceMemory struct {
+	size    int                  // The maximum number of nonces held
+	expires map[string]time.Time // The expiry time keyed on the nonce
+	order   []*nonceEntry        // The nonces in the order they were added
+	mutex   sync.Mutex           // Used to serialize access to the members
+}
+
+// nonceEntry is a nonce and the time it expires in the order of addition.
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// NewNonceMemory creates a new instance of NonceMemory holding at most size
+// nonces.
+func NewNonceMemory(size int) *NonceMemory {
+	return &NonceMemory{
+		size:    size,
+		expires: make(map[string]time.Time),
+		order:   make([]*nonceEntry, 0)}
+}
+
+// Add records the nonce until the expires time. Returns false if the nonce has
+// already been recorded and has not expired.
+func (m *NonceMemory) Add(nonce string, expires time.Time) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	n := time.Now().UTC()
+
+	// Check if the nonce has already been recorded.
+	if e, ok := m.expires[nonce]; ok && n.Before(e) {
+		return false, nil
+	}
+
+	// Remove nonces that have expired or are the oldest if the store is full.
+	for len(m.order) > 0 {
+		o := m.order[0]
+		if len(m.order) < m.size && n.Before(o.expires) {
+			break
+		}
+		if m.expires[o.nonce].Equal(o.expires) {
+			delete(m.expires, o.nonce)
+		}
+		m.order = m.order[1:]
+	}
+
+	// Record the nonce.
+	m.expires[nonce] = expires
+	m.order = append(m.order, &nonceEntry{nonce, expires})
+	return true, nil
+}
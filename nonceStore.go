@@ -0,0 +1,29 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import "time"
+
+// NonceStore interface for recording the encrypted results that have already
+// been decrypted when results can only be used once.
+type NonceStore interface {
+
+	// Add records the nonce until the expires time. Returns false if the nonce
+	// has already been recorded and has not expired, otherwise true. If an
+	// error is returned then the nonce may not have been recorded.
+	Add(nonce string, expires time.Time) (bool, error)
+}
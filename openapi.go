@@ -0,0 +1,142 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The OpenAPI document describing all the SWAN end points. Used both to
+// respond to callers requesting the document and to validate requests.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPI contains the parts of the OpenAPI document that are used to validate
+// requests. Members of the document that are only descriptive are ignored.
+type openAPI struct {
+	Paths      map[string]map[string]*apiOperation `json:"paths"`
+	Components struct {
+		Parameters map[string]*apiParameter `json:"parameters"`
+		Schemas    map[string]*apiSchema    `json:"schemas"`
+	} `json:"components"`
+}
+
+// apiOperation is an operation for a path and HTTP method.
+type apiOperation struct {
+	Parameters  []*apiParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *apiSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+// apiParameter is a query or form parameter for an operation.
+type apiParameter struct {
+	Ref      string     `json:"$ref"`
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required"`
+	Schema   *apiSchema `json:"schema"`
+	// The code to use if a required parameter is missing. Allows for the same
+	// error codes to be used as the handlers.
+	ErrorCode string `json:"x-swan-error-code"`
+}
+
+// apiSchema is the subset of the JSON schema used by the SWAN OpenAPI document.
+type apiSchema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Enum                 []string              `json:"enum"`
+	Minimum              *float64              `json:"minimum"`
+	Maximum              *float64              `json:"maximum"`
+	Required             []string              `json:"required"`
+	Properties           map[string]*apiSchema `json:"properties"`
+	AdditionalProperties interface{}           `json:"additionalProperties"`
+	Items                *apiSchema            `json:"items"`
+}
+
+// newOpenAPI parses the embedded OpenAPI document and resolves the parameter
+// references so that they are ready for request validation.
+func newOpenAPI() (*openAPI, error) {
+	var a openAPI
+	err := json.Unmarshal(openAPIDocument, &a)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range a.Paths {
+		for _, o := range p {
+			for i, v := range o.Parameters {
+				if v.Ref != "" {
+					n := a.Components.Parameters[refName(v.Ref)]
+					if n == nil {
+						return nil, fmt.Errorf(
+							"parameter '%s' not found", v.Ref)
+					}
+					o.Parameters[i] = n
+				}
+			}
+		}
+	}
+	return &a, nil
+}
+
+// getOperation returns the operation for the path and method, or nil if the
+// path is not described by the document. If the path exists, but the method
+// does not then an error is returned.
+func (a *openAPI) getOperation(path string, method string) (
+	*apiOperation,
+	error) {
+	p := a.Paths[path]
+	if p == nil {
+		return nil, nil
+	}
+	o := p[strings.ToLower(method)]
+	if o == nil {
+		return nil, newError(
+			ErrorCodeMethodNotAllowed,
+			fmt.Errorf("method '%s' not supported for '%s'", method, path))
+	}
+	return o, nil
+}
+
+// getSchema returns the schema resolving any reference to a component schema.
+func (a *openAPI) getSchema(s *apiSchema) *apiSchema {
+	for s != nil && s.Ref != "" {
+		s = a.Components.Schemas[refName(s.Ref)]
+	}
+	return s
+}
+
+// refName returns the name of the component from the end of the reference.
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// handlerOpenAPI returns the OpenAPI document describing the SWAN end points.
+func handlerOpenAPI(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sendResponse(s, w, r, "application/json", openAPIDocument)
+	}
+}
@@ -0,0 +1,159 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Values for the format parameter that controls how the fetch, update and stop
+// handlers respond with the storage operation URL.
+const (
+	formatText     = "text"     // The URL as plain text (default)
+	formatJSON     = "json"     // The URL and metadata as an Operation
+	formatRedirect = "redirect" // A 303 redirect to the URL
+)
+
+// Characters used by SWIFT in a key to indicate how conflicts are resolved.
+const conflictCharacters = "<>+"
+
+// Operation is returned by the fetch, update and stop handlers when the JSON
+// format is requested.
+type Operation struct {
+	// The URL to direct the web browser to in order to start the storage
+	// operation.
+	URL string `json:"url"`
+	// The date the values will be removed from the network for each of the
+	// keys written by the operation. Keys that are only read are not included.
+	Expires map[string]time.Time `json:"expires"`
+	// The internet domain of the SWIFT home node for the web browser.
+	HomeNode string `json:"homeNode"`
+	// True if a new SWID was created for the operation.
+	SWIDCreated bool `json:"swidCreated"`
+	// The time after which the URL is no longer valid and a new operation
+	// must be requested.
+	ValidUntil time.Time `json:"validUntil"`
+}
+
+// getFormat returns the format parameter from the request, removing it from
+// the form so that it is not treated as a SWIFT key. If the format is not
+// recognised then an error is returned.
+func getFormat(r *http.Request) (string, error) {
+	f := r.Form.Get("format")
+	r.Form.Del("format")
+	switch f {
+	case "":
+		return formatText, nil
+	case formatText, formatJSON, formatRedirect:
+		return f, nil
+	}
+	return "", newError(
+		ErrorCodeInvalidRequest,
+		fmt.Errorf("format '%s' must be text, json or redirect", f))
+}
+
+// getBool returns the boolean parameter k from the request, removing it from
+// the form so that it is not treated as a SWIFT key. False is returned if the
+// parameter is not present. If the value is not true or false then an error is
+// returned.
+func getBool(r *http.Request, k string) (bool, error) {
+	v := r.Form.Get(k)
+	r.Form.Del(k)
+	switch v {
+	case "", "false":
+		return false, nil
+	case "true":
+		return true, nil
+	}
+	return false, newError(
+		ErrorCodeInvalidRequest,
+		fmt.Errorf("%s '%s' must be true or false", k, v))
+}
+
+// getExpires returns the expiry date for each key in the SWIFT form values that
+// will be written by the storage operation. The stop list key is not included
+// as it is written with, and expires at the same time as, the stop key.
+func getExpires(q url.Values) map[string]time.Time {
+	m := make(map[string]time.Time)
+	for k := range q {
+		i := strings.IndexAny(k, conflictCharacters)
+		if i < 0 || i == len(k)-1 || k[:i] == stopListKey {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", k[i+1:])
+		if err == nil {
+			m[k[:i]] = t
+		}
+	}
+	return m
+}
+
+// newOperation creates the JSON representation of the storage operation. Must
+// be called after the storage operation URL has been created from the form.
+func newOperation(
+	s *services,
+	r *http.Request,
+	u string,
+	swidCreated bool) (*Operation, error) {
+	n, err := s.swift.GetHomeNode(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Operation{
+		URL:         u,
+		Expires:     getExpires(r.Form),
+		HomeNode:    n.Domain(),
+		SWIDCreated: swidCreated,
+		ValidUntil: time.Now().UTC().Add(
+			s.swift.Config().StorageOperationTimeoutDuration()),
+	}, nil
+}
+
+// sendOperation responds with the storage operation URL in the format
+// requested by the caller.
+func sendOperation(
+	s *services,
+	w http.ResponseWriter,
+	r *http.Request,
+	f string,
+	u string,
+	swidCreated bool) {
+	switch f {
+	case formatJSON:
+		o, err := newOperation(s, r, u, swidCreated)
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
+		}
+		j, err := json.Marshal(o)
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
+		}
+		sendJSON(s, w, r, j)
+	case formatRedirect:
+		w.Header().Set("Cache-Control", "no-cache")
+		http.Redirect(w, r, u, http.StatusSeeOther)
+	default:
+		sendResponse(s, w, r, "text/plain; charset=utf-8", []byte(u))
+	}
+}
@@ -0,0 +1,335 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/SWAN-community/owid-go"
+	"github.com/SWAN-community/swan-go"
+)
+
+// Operator provides the functions of the SWAN Operator to Go code in the same
+// process without the need for HTTP requests to the SWAN end points. The same
+// logic and access checks are used as the end points.
+// Each method requires the access key of the caller, and the internet domain
+// of the SWAN access node to use which must be registered with SWIFT and OWID.
+type Operator struct {
+	s *services
+}
+
+// NewOperator creates a new SWAN Operator configured from the JSON file
+// provided.
+// settingsFile path to the file that contains the configuration settings.
+// swanAccess an authorization instance used to valid access keys.
+// Returns an error if the configuration settings are not valid.
+func NewOperator(settingsFile string, swanAccess Access) (*Operator, error) {
+	s, err := newServices(settingsFile, swanAccess)
+	if err != nil {
+		return nil, err
+	}
+	return &Operator{s}, nil
+}
+
+// SetNonceStore sets the store used to record decrypted results when results
+// are single use. Must be called before the operator is used. Replaces the
+// in memory store for operators running in more than one process.
+// nonces the store to record decrypted results in.
+func (o *Operator) SetNonceStore(nonces NonceStore) {
+	o.s.nonces = nonces
+}
+
+// AddHandlers adds the swift, owid and swan end points for the operator.
+// malformedHandler if SWAN can't handle the request the handler to use instead.
+func (o *Operator) AddHandlers(
+	malformedHandler func(w http.ResponseWriter, r *http.Request)) {
+	addHandlers(o.s, malformedHandler)
+}
+
+// Fetch returns the storage operation to retrieve the most current data from
+// the SWAN network. b is the request from the web browser and is used to
+// determine the home node.
+func (o *Operator) Fetch(
+	accessKey string,
+	host string,
+	b *http.Request,
+	q *FetchRequest) (*Operation, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, b, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	u, err := fetch(o.s, r, d)
+	if err != nil {
+		return nil, err
+	}
+	return newOperation(o.s, r, u, false)
+}
+
+// FetchUpdate returns the storage operation to update the SWAN network with
+// the values provided and retrieve the most current data for all the other
+// fields. b is the request from the web browser and is used to determine the
+// home node.
+func (o *Operator) FetchUpdate(
+	accessKey string,
+	host string,
+	b *http.Request,
+	q *UpdateRequest) (*Operation, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, b, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	u, err := fetchUpdate(o.s, r, d)
+	if err != nil {
+		return nil, err
+	}
+	return newOperation(o.s, r, u, false)
+}
+
+// Update returns the storage operation to update the SWAN network with the
+// values provided. b is the request from the web browser and is used to
+// determine the home node.
+func (o *Operator) Update(
+	accessKey string,
+	host string,
+	b *http.Request,
+	q *UpdateRequest) (*Operation, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, b, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	u, c, err := update(o.s, r, d)
+	if err != nil {
+		return nil, err
+	}
+	return newOperation(o.s, r, u, c)
+}
+
+// Stop returns the storage operation to add the host to the user's stopped
+// domains. b is the request from the web browser and is used to determine the
+// home node.
+func (o *Operator) Stop(
+	accessKey string,
+	host string,
+	b *http.Request,
+	q *StopRequest) (*Operation, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, b, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	u, err := stop(o.s, r, d)
+	if err != nil {
+		return nil, err
+	}
+	return newOperation(o.s, r, u, false)
+}
+
+// Unstop returns the storage operation to remove the hosts from the user's
+// stopped domains. b is the request from the web browser and is used to
+// determine the home node.
+func (o *Operator) Unstop(
+	accessKey string,
+	host string,
+	b *http.Request,
+	q *UnstopRequest) (*Operation, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, b, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	u, err := unstop(o.s, r, d)
+	if err != nil {
+		return nil, err
+	}
+	return newOperation(o.s, r, u, false)
+}
+
+// Forget returns the storage operation to erase all the user's SWAN data. b is
+// the request from the web browser and is used to determine the home node.
+func (o *Operator) Forget(
+	accessKey string,
+	host string,
+	b *http.Request,
+	q *ForgetRequest) (*Operation, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, b, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	u, c, err := forget(o.s, r, d)
+	if err != nil {
+		return nil, err
+	}
+	return newOperation(o.s, r, u, c)
+}
+
+// DryRunUpdate validates the values of the update request and returns the
+// values that would be written without creating a storage operation.
+func (o *Operator) DryRunUpdate(
+	accessKey string,
+	host string,
+	q *UpdateRequest) (*DryRun, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, nil, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	return checkUpdate(o.s, r, d), nil
+}
+
+// DryRunStop validates the values of the stop request and returns the values
+// that would be written without creating a storage operation.
+func (o *Operator) DryRunStop(
+	accessKey string,
+	host string,
+	q *StopRequest) (*DryRun, error) {
+	d, err := q.getRetentionDays(&o.s.config)
+	if err != nil {
+		return nil, err
+	}
+	r, err := o.newRequest(accessKey, host, nil, q.toForm())
+	if err != nil {
+		return nil, err
+	}
+	return checkStop(o.s, r, d), nil
+}
+
+// Decrypt returns the SWAN pairs from the encrypted results appended to the
+// return URL. The email is converted to a SID.
+func (o *Operator) Decrypt(
+	accessKey string,
+	host string,
+	encrypted string) ([]*swan.Pair, error) {
+	r, err := o.newRequest(accessKey, host, nil, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	v, err := decodeResults(o.s, r, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	p, err := convertPairs(o.s, r, v.Map())
+	if err != nil {
+		return nil, newError(ErrorCodeInvalidData, err)
+	}
+	err = useResults(o.s, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Revalidate returns advice on whether the pairs previously returned by
+// Decrypt can still be used. fields are the fields option used with the fetch
+// that returned the pairs, or nil if all the fields were fetched.
+func (o *Operator) Revalidate(
+	accessKey string,
+	host string,
+	p []*swan.Pair,
+	fields []string) (*Revalidation, error) {
+	_, err := o.newRequest(accessKey, host, nil, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	f, err := getRevalidateFields(fields)
+	if err != nil {
+		return nil, err
+	}
+	return revalidate(o.s, p, f), nil
+}
+
+// CreateSWID returns a new SWID created by the SWAN Operator.
+func (o *Operator) CreateSWID(accessKey string, host string) (
+	*owid.OWID,
+	error) {
+	r, err := o.newRequest(accessKey, host, nil, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	return createSWID(o.s, r)
+}
+
+// newRequest checks the access key is allowed and that the host is an access
+// node, and then returns a request for the host containing the form values
+// provided that can be used with the same logic as the handlers. The IP
+// address and X-Forwarded-For header of the web browser request b, if
+// provided, are added to the form values to determine the home node unless the
+// form values already contain them.
+func (o *Operator) newRequest(
+	accessKey string,
+	host string,
+	b *http.Request,
+	q url.Values) (*http.Request, error) {
+
+	// Validate that the access key provided is valid in the access provider.
+	v, err := o.s.access.GetAllowed(accessKey)
+	if v == false || err != nil {
+		return nil, newError(
+			ErrorCodeAccessDenied,
+			fmt.Errorf("Access denied. Verify accessKey"))
+	}
+
+	// Check that the host relates to a valid access node.
+	a, err := o.s.swift.GetAccessNodeForHost(host)
+	if err != nil {
+		return nil, newError(ErrorCodeInvalidAccessNode, err)
+	}
+	if a == nil {
+		return nil, newError(
+			ErrorCodeInvalidAccessNode,
+			fmt.Errorf("'%s' not a valid SWAN access node", host))
+	}
+
+	// Create the request for the host.
+	r := &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Host: host},
+		Host:   host,
+		Header: make(http.Header),
+		Form:   q}
+	if b != nil && q.Get("remoteAddr") == "" && q.Get("X-Forwarded-For") == "" {
+		setIfPresent(q, "remoteAddr", b.RemoteAddr)
+		setIfPresent(q, "X-Forwarded-For", b.Header.Get("X-Forwarded-For"))
+	}
+	return withAccessKey(r, accessKey), nil
+}
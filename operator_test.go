@@ -0,0 +1,60 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// TestOperatorFetchHomeNode checks that the IP address of the web browser
+// request is used to determine the home node of the operation.
+func TestOperatorFetchHomeNode(t *testing.T) {
+	o := &Operator{newTestServices(t)}
+	h := make(map[string]bool)
+	for _, ip := range []string{"192.0.2.1", "198.51.100.7", "203.0.113.12"} {
+
+		// Get the home node expected for the IP address.
+		e, err := o.s.swift.GetHomeNode(&http.Request{
+			Host: testAccessNode,
+			Form: url.Values{"remoteAddr": {ip + ":1234"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		h[e.Domain()] = true
+
+		// Create the operation for the web browser request.
+		b := &http.Request{RemoteAddr: ip + ":1234", Header: http.Header{}}
+		q := &FetchRequest{Fields: []string{"pref"}}
+		q.ReturnURL = "https://publisher.test/return"
+		p, err := o.Fetch(testAccessKey, testAccessNode, b, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.HomeNode != e.Domain() {
+			t.Fatalf("expected home node '%s' for '%s' but got '%s'",
+				e.Domain(), ip, p.HomeNode)
+		}
+	}
+
+	// The IP addresses must not all share a home node otherwise the test does
+	// not show that the IP address was used.
+	if len(h) < 2 {
+		t.Fatal("expected more than one home node")
+	}
+}
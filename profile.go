@@ -0,0 +1,101 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Profile contains the user interface parameters for storage operations that
+// a publisher would otherwise need to provide with every request. Parameters
+// provided with the request take precedence over those in the profile.
+type Profile struct {
+	Title string `json:"title"`
+	// The message displayed for operations that have no message template.
+	Message         string `json:"message"`
+	BackgroundColor string `json:"backgroundColor"`
+	MessageColor    string `json:"messageColor"`
+	ProgressColor   string `json:"progressColor"`
+	// The URL the web browser is returned to if none is provided.
+	ReturnURL string `json:"returnUrl"`
+}
+
+// setProfile sets the parameters from the profile named in the profile
+// parameter, or the publisher's default profile, where they have not been
+// provided in the request. The profile's message is only used if there is no
+// message template for the operation o. The profile parameter is removed from
+// the form so that it is not treated as a SWIFT key. If the profile named does
+// not exist for the publisher then an error is returned.
+func setProfile(s *services, r *http.Request, o string) error {
+
+	// Get the name of the profile to use.
+	n := r.Form.Get("profile")
+	r.Form.Del("profile")
+	p := s.config.getPublisher(r)
+	if n == "" {
+		if p == nil || p.DefaultProfile == "" {
+			return nil
+		}
+		n = p.DefaultProfile
+	}
+
+	// Find the profile for the publisher.
+	var f *Profile
+	if p != nil {
+		f = p.Profiles[n]
+	}
+	if f == nil {
+		return newError(
+			ErrorCodeInvalidRequest,
+			fmt.Errorf("profile '%s' not configured for the access key", n))
+	}
+
+	// Set the parameters that have not been provided by the caller.
+	setIfMissing(r, "title", f.Title)
+	if s.config.hasMessage(r, o) == false {
+		setIfMissing(r, "message", f.Message)
+	}
+	setIfMissing(r, "backgroundColor", f.BackgroundColor)
+	setIfMissing(r, "messageColor", f.MessageColor)
+	setIfMissing(r, "progressColor", f.ProgressColor)
+	setIfMissing(r, "returnUrl", f.ReturnURL)
+	return nil
+}
+
+// setIfMissing sets the form parameter k to v if v is not empty and the form
+// does not already contain a value for k.
+func setIfMissing(r *http.Request, k string, v string) {
+	if v != "" && r.Form.Get(k) == "" {
+		r.Form.Set(k, v)
+	}
+}
+
+// validateProfiles checks that the default profile for each publisher, if
+// any, is one of the publisher's profiles.
+func (c *Configuration) validateProfiles() error {
+	for _, p := range c.Publishers {
+		if p != nil && p.DefaultProfile != "" &&
+			p.Profiles[p.DefaultProfile] == nil {
+			return fmt.Errorf(
+				"%s default profile '%s' not configured",
+				p.describe(),
+				p.DefaultProfile)
+		}
+	}
+	return nil
+}
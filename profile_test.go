@@ -0,0 +1,58 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// TestProfileMessage checks that the profile's message is only used for
+// operations that do not have a message template.
+func TestProfileMessage(t *testing.T) {
+	s := &services{config: Configuration{Publishers: map[string]*Publisher{
+		"k": {
+			DefaultProfile: "p",
+			Profiles:       map[string]*Profile{"p": {Message: "Profile"}}}}}}
+	s.config.setDefaultMessages()
+	for _, c := range []struct {
+		o string
+		m string
+	}{
+		{messageFetch, "Profile"},
+		{messageStop, "Bye, bye a.com. Thanks for telling the world."}} {
+		r := &http.Request{Form: url.Values{}}
+		r = r.WithContext(
+			context.WithValue(context.Background(), accessKeyContextKey, "k"))
+		err := setProfile(s, r, c.o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = setMessage(s, r, c.o, "a.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Form.Get("message") != c.m {
+			t.Fatalf("%s expected '%s' but got '%s'",
+				c.o,
+				c.m,
+				r.Form.Get("message"))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Publisher contains settings that apply to the requests made with a specific
+// access key. Publishers are configured in the publishers section of the
+// settings file keyed on the access key.
+type Publisher struct {
+	// The name of the publisher. Access keys with the same name can decrypt
+	// the results of each other's storage operations. Empty to restrict
+	// results to the access key that initiated the operation.
+	Name string `json:"name"`
+	// Message templates that take precedence over the configured messages
+	// for requests made with the access key.
+	Messages Messages `json:"messages"`
+	// User interface profiles keyed on the name callers use to reference
+	// them.
+	Profiles map[string]*Profile `json:"profiles"`
+	// The name of the profile used when the caller does not name one. Empty
+	// for no default profile.
+	DefaultProfile string `json:"defaultProfile"`
+	// The origins that return URLs must match. Each is a host, or a scheme
+	// and host, with an optional port. A missing port matches the default
+	// port of the scheme. The host can start with *. to match any subdomain.
+	// Empty to allow any return URL.
+	ReturnOrigins []string `json:"returnOrigins"`
+}
+
+// Type used for the context key to avoid collisions with other packages.
+type contextKey string
+
+// The context key used to hold the access key once it has been removed from
+// the form.
+const accessKeyContextKey = contextKey("accessKey")
+
+// withAccessKey returns a copy of the request with the access key k recorded
+// in the context so that publisher settings can be found after the accessKey
+// parameter has been removed from the form.
+func withAccessKey(r *http.Request, k string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), accessKeyContextKey, k))
+}
+
+// getAccessKey returns the access key recorded in the request context, or an
+// empty string if there is no access key.
+func getAccessKey(r *http.Request) string {
+	k, _ := r.Context().Value(accessKeyContextKey).(string)
+	return k
+}
+
+// getPublisher returns the publisher settings for the access key used with the
+// request, or nil if there are no settings for the access key.
+func (c *Configuration) getPublisher(r *http.Request) *Publisher {
+	return c.Publishers[getAccessKey(r)]
+}
+
+// describe returns the publisher as it appears in configuration errors. The
+// access key the publisher is configured with is never used as it is secret
+// and errors are written to logs.
+func (p *Publisher) describe() string {
+	if p.Name == "" {
+		return "publisher without a name"
+	}
+	return fmt.Sprintf("publisher '%s'", p.Name)
+}
@@ -0,0 +1,96 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"github.com/SWAN-community/salt-go"
+	"net/http"
+	"net/mail"
+)
+
+// The form parameters that can contain raw values for the SWAN keys. Raw
+// values are signed by the SWAN Operator so that callers do not need to
+// operate their own OWID creator.
+var rawParameters = map[string]string{
+	"pref":  "rawPref",
+	"email": "rawEmail",
+	"salt":  "rawSalt",
+}
+
+// checkRaw returns the raw value for the SWAN key k removing the parameter from
+// the form. An empty string is returned if no raw value is provided. An error
+// is returned if the raw value is not valid or an OWID is also provided for the
+// same key.
+func checkRaw(r *http.Request, k string) (string, error) {
+	p := rawParameters[k]
+	if p == "" {
+		return "", nil
+	}
+	v := r.Form.Get(p)
+	r.Form.Del(p)
+	if v == "" {
+		return "", nil
+	}
+	if r.Form.Get(k) != "" {
+		return "", newError(ErrorCodeInvalidRequest, fmt.Errorf(
+			"only one of '%s' or '%s' can be provided", k, p))
+	}
+	err := validateRaw(k, v)
+	if err != nil {
+		return "", newError(ErrorCodeInvalidData, fmt.Errorf(
+			"'%s' %s", p, err.Error()))
+	}
+	return v, nil
+}
+
+// validateRaw checks that the raw value is valid for the SWAN key. The email
+// must be a plain email address, and the salt must be the base 64 string
+// returned from salt-js.
+func validateRaw(k string, v string) error {
+	switch k {
+	case "email":
+		a, err := mail.ParseAddress(v)
+		if err != nil {
+			return err
+		}
+		if a.Address != v {
+			return fmt.Errorf("must be a plain email address")
+		}
+	case "salt":
+		_, err := salt.FromBase64(v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getSignedRaw returns the raw value for the SWAN key k as an OWID signed by
+// the SWAN Operator in base 64. An empty string is returned if no raw value is
+// provided.
+func getSignedRaw(s *services, r *http.Request, k string) (string, error) {
+	v, err := checkRaw(r, k)
+	if err != nil || v == "" {
+		return "", err
+	}
+	o, err := createOWID(s, r, []byte(v))
+	if err != nil {
+		return "", err
+	}
+	return o.AsBase64()
+}
@@ -0,0 +1,297 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"github.com/SWAN-community/swan-go"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// UIOptions controls the user interface displayed by SWIFT during a storage
+// operation. Empty values use the defaults configured for the SWIFT network.
+type UIOptions struct {
+	Title           string `json:"title,omitempty"`
+	Message         string `json:"message,omitempty"`
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+	MessageColor    string `json:"messageColor,omitempty"`
+	ProgressColor   string `json:"progressColor,omitempty"`
+	// The language used to select the message template when no message is
+	// provided. For example en or en-GB.
+	Language string `json:"language,omitempty"`
+	// False to perform the storage operation without a user interface.
+	DisplayUserInterface *bool `json:"displayUserInterface,omitempty"`
+	// True to return the results to the parent window with postMessage rather
+	// than redirecting to the return URL.
+	PostMessageOnComplete *bool `json:"postMessageOnComplete,omitempty"`
+	// True to respond with JavaScript that continues the operation.
+	JavaScript *bool `json:"javaScript,omitempty"`
+}
+
+// OperationRequest contains the members common to all v2 storage operation
+// requests.
+type OperationRequest struct {
+	// The URL the web browser is returned to with the encrypted results.
+	// Optional if the profile provides a return URL.
+	ReturnURL string `json:"returnUrl"`
+	// The name of the user interface profile configured for the access key.
+	// Values in UI and ReturnURL take precedence over the profile.
+	Profile string `json:"profile,omitempty"`
+	// The number of days values written by the operation are retained for.
+	// Zero uses the operator's configured value which is also the maximum.
+	RetentionDays int `json:"retentionDays,omitempty"`
+	// Options for the user interface.
+	UI UIOptions `json:"ui"`
+	// Optional state returned unaltered with the results.
+	State []string `json:"state,omitempty"`
+	// The IP address of the web browser. Used with XForwardedFor to determine
+	// the SWIFT home node for the web browser.
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	// The X-Forwarded-For header of the web browser's request, if any.
+	XForwardedFor string `json:"xForwardedFor,omitempty"`
+}
+
+// FetchDefaults are values currently held by the caller that are used if the
+// SWAN network does not contain a value. SWID, Pref, Email and Salt are base 64
+// OWIDs.
+type FetchDefaults struct {
+	SWID  string `json:"swid,omitempty"`
+	Pref  string `json:"pref,omitempty"`
+	Email string `json:"email,omitempty"`
+	Salt  string `json:"salt,omitempty"`
+	// The stop value previously returned by decrypt.
+	Stop string `json:"stop,omitempty"`
+}
+
+// FetchRequest is the JSON body of a v2 fetch request.
+type FetchRequest struct {
+	OperationRequest
+	// False if the SWAN network must be consulted irrespective of the data
+	// held on the home node.
+	UseHomeNode *bool         `json:"useHomeNode,omitempty"`
+	Defaults    FetchDefaults `json:"defaults"`
+	// The fields to fetch. sid requests the email and salt. All the fields
+	// are fetched if none are provided.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// UpdateValues are the values to write to the SWAN network. Empty values are
+// not changed. SWID, Pref, Email and Salt are base 64 OWIDs. The raw values
+// are signed by the SWAN Operator and can be used instead of the OWIDs.
+type UpdateValues struct {
+	SWID  string `json:"swid,omitempty"`
+	Pref  string `json:"pref,omitempty"`
+	Email string `json:"email,omitempty"`
+	Salt  string `json:"salt,omitempty"`
+	// The preferences payload.
+	RawPref string `json:"rawPref,omitempty"`
+	// A plain email address.
+	RawEmail string `json:"rawEmail,omitempty"`
+	// The salt as the base 64 string returned from salt-js.
+	RawSalt string `json:"rawSalt,omitempty"`
+	// The keys to delete from pref, email, salt, or sid for both the email and
+	// salt.
+	Delete []string `json:"delete,omitempty"`
+	// A domain to add to the stopped domains.
+	Stop string `json:"stop,omitempty"`
+	// Domains to remove from the stopped domains. Stopped must also be
+	// provided.
+	Unstop []string `json:"unstop,omitempty"`
+	// The stop value previously returned by decrypt. Required with Unstop.
+	Stopped *string `json:"stopped,omitempty"`
+}
+
+// UpdateRequest is the JSON body of a v2 update request.
+type UpdateRequest struct {
+	OperationRequest
+	Values UpdateValues `json:"values"`
+	// True to validate the values and return a DryRun report rather than an
+	// Operation. Use the DryRun methods of Operator and Client.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// StopRequest is the JSON body of a v2 stop request.
+type StopRequest struct {
+	OperationRequest
+	// The domain to add to the stopped domains.
+	Host string `json:"host"`
+	// The stop value previously returned by decrypt. If provided the stopped
+	// domains are pruned and replaced. See FormatStoppedDomains.
+	Stopped *string `json:"stopped,omitempty"`
+	// True to validate the values and return a DryRun report rather than an
+	// Operation. Use the DryRun methods of Operator and Client.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// UnstopRequest is the JSON body of a v2 unstop request.
+type UnstopRequest struct {
+	OperationRequest
+	// The domains to remove from the stopped domains.
+	Hosts []string `json:"hosts"`
+	// The stop value previously returned by decrypt.
+	Stopped *string `json:"stopped"`
+}
+
+// EvaluateStopRequest is the JSON body of a v2 evaluate-stop request.
+type EvaluateStopRequest struct {
+	// The stop pair previously returned by decrypt.
+	Stop StopPair `json:"stop"`
+	// The domains to check against the stopped domains.
+	Candidates []string `json:"candidates"`
+}
+
+// ForgetRequest is the JSON body of a v2 forget request.
+type ForgetRequest struct {
+	OperationRequest
+	// True to write a new SWID in place of the erased one.
+	NewSWID bool `json:"newSWID,omitempty"`
+}
+
+// DecryptRequest is the JSON body of a v2 decrypt or decrypt-raw request.
+type DecryptRequest struct {
+	// The encrypted value appended to the return URL by SWIFT.
+	Encrypted string `json:"encrypted"`
+	// True to include the structured stop list in the stop pair. Only used
+	// by decrypt.
+	StopList bool `json:"stopList,omitempty"`
+}
+
+// RevalidateRequest is the JSON body of a v2 revalidate request.
+type RevalidateRequest struct {
+	// The pairs previously returned by decrypt including the val pair.
+	Pairs []*swan.Pair `json:"pairs"`
+	// The fields option used with the fetch that returned the pairs. The SWID
+	// is only required if it was fetched. All the fields are assumed if none
+	// are provided.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// getRetentionDays returns the number of days values should be retained for.
+// If the request does not specify a value then the configured maximum is used.
+func (o *OperationRequest) getRetentionDays(c *Configuration) (int, error) {
+	if o.RetentionDays == 0 {
+		return c.DeleteDays, nil
+	}
+	if o.RetentionDays < 0 || o.RetentionDays > c.DeleteDays {
+		return 0, newError(ErrorCodeInvalidRequest, fmt.Errorf(
+			"retentionDays must be between 1 and %d", c.DeleteDays))
+	}
+	return o.RetentionDays, nil
+}
+
+// toForm adds the members to the form values in the format used by the shared
+// storage operation logic.
+func (o *OperationRequest) toForm(q url.Values) {
+	q.Set("returnUrl", o.ReturnURL)
+	setIfPresent(q, "profile", o.Profile)
+	setIfPresent(q, "title", o.UI.Title)
+	setIfPresent(q, "message", o.UI.Message)
+	setIfPresent(q, "backgroundColor", o.UI.BackgroundColor)
+	setIfPresent(q, "messageColor", o.UI.MessageColor)
+	setIfPresent(q, "progressColor", o.UI.ProgressColor)
+	setIfPresent(q, "language", o.UI.Language)
+	setBoolIfPresent(q, "displayUserInterface", o.UI.DisplayUserInterface)
+	setBoolIfPresent(q, "postMessageOnComplete", o.UI.PostMessageOnComplete)
+	setBoolIfPresent(q, "javaScript", o.UI.JavaScript)
+	if len(o.State) > 0 {
+		q["state"] = o.State
+	}
+	setIfPresent(q, "remoteAddr", o.RemoteAddr)
+	setIfPresent(q, "X-Forwarded-For", o.XForwardedFor)
+}
+
+// toForm returns the request as form values.
+func (f *FetchRequest) toForm() url.Values {
+	q := make(url.Values)
+	f.OperationRequest.toForm(q)
+	setBoolIfPresent(q, "useHomeNode", f.UseHomeNode)
+	setIfPresent(q, "swid", f.Defaults.SWID)
+	setIfPresent(q, "pref", f.Defaults.Pref)
+	setIfPresent(q, "email", f.Defaults.Email)
+	setIfPresent(q, "salt", f.Defaults.Salt)
+	setIfPresent(q, "stop", f.Defaults.Stop)
+	setIfPresent(q, "fields", strings.Join(f.Fields, ","))
+	return q
+}
+
+// toForm returns the request as form values.
+func (u *UpdateRequest) toForm() url.Values {
+	q := make(url.Values)
+	u.OperationRequest.toForm(q)
+	setIfPresent(q, "swid", u.Values.SWID)
+	setIfPresent(q, "pref", u.Values.Pref)
+	setIfPresent(q, "email", u.Values.Email)
+	setIfPresent(q, "salt", u.Values.Salt)
+	setIfPresent(q, "rawPref", u.Values.RawPref)
+	setIfPresent(q, "rawEmail", u.Values.RawEmail)
+	setIfPresent(q, "rawSalt", u.Values.RawSalt)
+	setIfPresent(q, "delete", strings.Join(u.Values.Delete, ","))
+	setIfPresent(q, "stop", u.Values.Stop)
+	setIfPresent(q, "unstop", strings.Join(u.Values.Unstop, ","))
+	if u.Values.Stopped != nil {
+		q.Set("stopped", *u.Values.Stopped)
+	}
+	return q
+}
+
+// toForm returns the request as form values.
+func (s *StopRequest) toForm() url.Values {
+	q := make(url.Values)
+	s.OperationRequest.toForm(q)
+	setIfPresent(q, "host", s.Host)
+	if s.Stopped != nil {
+		q.Set("stopped", *s.Stopped)
+	}
+	return q
+}
+
+// toForm returns the request as form values.
+func (u *UnstopRequest) toForm() url.Values {
+	q := make(url.Values)
+	u.OperationRequest.toForm(q)
+	setIfPresent(q, "host", strings.Join(u.Hosts, ","))
+	if u.Stopped != nil {
+		q.Set("stopped", *u.Stopped)
+	}
+	return q
+}
+
+// toForm returns the request as form values.
+func (f *ForgetRequest) toForm() url.Values {
+	q := make(url.Values)
+	f.OperationRequest.toForm(q)
+	if f.NewSWID {
+		q.Set("newSWID", "true")
+	}
+	return q
+}
+
+// setIfPresent sets the key to the value if the value is not empty.
+func setIfPresent(q url.Values, k string, v string) {
+	if v != "" {
+		q.Set(k, v)
+	}
+}
+
+// setBoolIfPresent sets the key to "true" or "false" if the value is not nil.
+func setBoolIfPresent(q url.Values, k string, v *bool) {
+	if v != nil {
+		q.Set(k, strconv.FormatBool(*v))
+	}
+}
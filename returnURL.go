@@ -0,0 +1,153 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"github.com/SWAN-community/swift-go"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The prefix of an allowed return URL host that matches any subdomain.
+const returnWildcard = "*."
+
+// returnOrigin is a parsed entry from the publisher's allowed return URL
+// origins.
+type returnOrigin struct {
+	scheme   string // The scheme or empty for any scheme
+	host     string // The host without any wildcard or port
+	port     string // The port or empty for the default port of the scheme
+	wildcard bool   // True if any subdomain of the host is allowed
+}
+
+// The port used for each scheme when a URL does not contain one.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// setReturnURL validates and sets the return URL. If the publisher associated
+// with the request has allowed return URL origins then the return URL must
+// match one of them. If https is required then the return URL must use the
+// https scheme unless debug is enabled.
+func setReturnURL(s *services, r *http.Request) error {
+	err := swift.SetURL("returnUrl", "returnUrl", &r.Form)
+	if err != nil {
+		return newError(ErrorCodeInvalidReturnURL, err)
+	}
+	u, err := url.Parse(r.Form.Get("returnUrl"))
+	if err != nil {
+		return newError(ErrorCodeInvalidReturnURL, err)
+	}
+	if s.config.ReturnURLHTTPS && s.config.Debug == false &&
+		u.Scheme != "https" {
+		return newError(
+			ErrorCodeInvalidReturnURL,
+			fmt.Errorf("returnUrl '%s' must use https", u))
+	}
+	p := s.config.getPublisher(r)
+	if p == nil || len(p.ReturnOrigins) == 0 {
+		return nil
+	}
+	for _, i := range p.ReturnOrigins {
+		o, err := parseReturnOrigin(i)
+		if err == nil && o.matches(u) {
+			return nil
+		}
+	}
+	return newError(
+		ErrorCodeInvalidReturnURL,
+		fmt.Errorf(
+			"returnUrl origin '%s://%s' not allowed for the access key",
+			u.Scheme,
+			u.Host))
+}
+
+// parseReturnOrigin returns the origin for the value v which is either a host,
+// or a scheme and host, with an optional port. For example example.com,
+// https://example.com or https://*.example.com:8080. The host can start with
+// *. to allow any subdomain of the host.
+func parseReturnOrigin(v string) (*returnOrigin, error) {
+	var o returnOrigin
+	h := strings.ToLower(strings.TrimSpace(v))
+	if i := strings.Index(h, "://"); i >= 0 {
+		o.scheme = h[:i]
+		h = h[i+3:]
+	}
+	if strings.HasPrefix(h, returnWildcard) {
+		o.wildcard = true
+		h = h[len(returnWildcard):]
+	}
+	if i := strings.LastIndex(h, ":"); i >= 0 {
+		o.port = h[i+1:]
+		h = h[:i]
+		_, err := strconv.ParseUint(o.port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("return origin '%s' port invalid", v)
+		}
+	}
+	if h == "" || strings.ContainsAny(h, "/?#*@:") {
+		return nil, fmt.Errorf("return origin '%s' invalid", v)
+	}
+	o.host = h
+	return &o, nil
+}
+
+// matches returns true if the URL u has the scheme, host and port of the
+// origin. Wildcard origins match any subdomain of the host but not the host
+// itself. A missing port on either side is the default port for the scheme of
+// the URL so that https://example.com and https://example.com:443 match.
+func (o *returnOrigin) matches(u *url.URL) bool {
+	c := strings.ToLower(u.Scheme)
+	if o.scheme != "" && o.scheme != c {
+		return false
+	}
+	if getPort(c, u.Port()) != getPort(c, o.port) {
+		return false
+	}
+	h := strings.ToLower(u.Hostname())
+	if o.wildcard {
+		return strings.HasSuffix(h, "."+o.host)
+	}
+	return h == o.host
+}
+
+// getPort returns the port p, or the default port for the scheme c if p is
+// empty.
+func getPort(c string, p string) string {
+	if p == "" {
+		return defaultPorts[c]
+	}
+	return p
+}
+
+// validateReturnOrigins checks that the allowed return URL origins for each
+// publisher can be parsed.
+func (c *Configuration) validateReturnOrigins() error {
+	for _, p := range c.Publishers {
+		if p == nil {
+			continue
+		}
+		for _, i := range p.ReturnOrigins {
+			_, err := parseReturnOrigin(i)
+			if err != nil {
+				return fmt.Errorf("%s %s", p.describe(), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// TestReturnOriginMatches checks the return URLs matched by allowed origins.
+func TestReturnOriginMatches(t *testing.T) {
+	for _, c := range []struct {
+		origin string
+		url    string
+		match  bool
+	}{
+		// Wildcards match any subdomain but not the host itself.
+		{"*.example.com", "https://a.example.com/", true},
+		{"*.example.com", "https://a.b.example.com/", true},
+		{"*.example.com", "https://example.com/", false},
+		{"*.example.com", "https://badexample.com/", false},
+		{"example.com", "https://a.example.com/", false},
+
+		// Origins without a scheme match any scheme.
+		{"example.com", "https://example.com/", true},
+		{"example.com", "http://example.com/", true},
+		{"https://example.com", "http://example.com/", false},
+		{"HTTPS://Example.COM", "https://example.com/page", true},
+
+		// A missing port is the default port of the scheme.
+		{"https://example.com", "https://example.com:443/", true},
+		{"https://example.com:443", "https://example.com/", true},
+		{"https://example.com", "https://example.com:8443/", false},
+		{"https://example.com:8443", "https://example.com:8443/", true},
+		{"https://example.com:8443", "https://example.com/", false},
+		{"example.com:80", "http://example.com/", true},
+		{"example.com:80", "https://example.com/", false},
+		{"*.example.com:8080", "http://a.example.com:8080/", true},
+	} {
+		o, err := parseReturnOrigin(c.origin)
+		if err != nil {
+			t.Fatalf("'%s' %s", c.origin, err)
+		}
+		u, err := url.Parse(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o.matches(u) != c.match {
+			t.Errorf("expected '%s' match '%s' to be %v",
+				c.origin,
+				c.url,
+				c.match)
+		}
+	}
+}
+
+// TestParseReturnOriginInvalid checks that origins that can not be matched are
+// rejected.
+func TestParseReturnOriginInvalid(t *testing.T) {
+	for _, i := range []string{
+		"",
+		"https://",
+		"*.",
+		"example.com:99999",
+		"example.com:port",
+		"example.com/path",
+		"user@example.com",
+		"a.*.example.com"} {
+		_, err := parseReturnOrigin(i)
+		if err == nil {
+			t.Errorf("expected '%s' to be invalid", i)
+		}
+	}
+}
+
+// TestSetReturnURL checks that https is required when configured, unless debug
+// is enabled, and that the publisher's allowed origins are applied.
+func TestSetReturnURL(t *testing.T) {
+	s := &services{config: Configuration{
+		ReturnURLHTTPS: true,
+		Publishers: map[string]*Publisher{
+			"k": {ReturnOrigins: []string{"*.example.com"}}}}}
+	for _, c := range []struct {
+		key   string
+		url   string
+		debug bool
+		valid bool
+	}{
+		{"", "https://example.com/", false, true},
+		{"", "http://example.com/", false, false},
+		{"", "http://example.com/", true, true},
+		{"k", "https://www.example.com/", false, true},
+		{"k", "https://example.com/", false, false},
+		{"k", "https://www.example.org/", false, false},
+	} {
+		s.config.Debug = c.debug
+		r := &http.Request{Form: url.Values{"returnUrl": {c.url}}}
+		r = r.WithContext(
+			context.WithValue(context.Background(), accessKeyContextKey, c.key))
+		err := setReturnURL(s, r)
+		if c.valid && err != nil {
+			t.Errorf("expected '%s' to be valid but got %s", c.url, err)
+		}
+		if c.valid == false &&
+			getErrorCode(err, "") != ErrorCodeInvalidReturnURL {
+			t.Errorf("expected '%s' to be invalid but got %v", c.url, err)
+		}
+	}
+}
+
+// TestValidateReturnOrigins checks that the access key is not included in the
+// error for an invalid origin.
+func TestValidateReturnOrigins(t *testing.T) {
+	c := &Configuration{Publishers: map[string]*Publisher{
+		"secret-key": {Name: "News", ReturnOrigins: []string{"a.com/x"}}}}
+	err := c.validateReturnOrigins()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if err.Error() != "publisher 'News' return origin 'a.com/x' invalid" {
+		t.Fatalf("unexpected error '%s'", err)
+	}
+}
@@ -36,12 +36,16 @@ type services struct {
 	swift  *swift.Services // Services used by the SWIFT network
 	owid   *owid.Services  // Services used for OWID creation and verification
 	access Access          // Instance of access service
+	api    *openAPI        // OpenAPI document used to validate requests
+	nonces NonceStore      // Decrypted results or nil if not single use
 }
 
 // newServices a set of services to use with SWAN. These provide defaults via
 // the configuration parameter, and access to persistent storage via the store
-// parameter.
-func newServices(settingsFile string, swanAccess Access) *services {
+// parameter. An error is returned if the configuration is not valid.
+func newServices(
+	settingsFile string,
+	swanAccess Access) (*services, error) {
 	var swiftStores []swift.Store
 	var owidStore owid.Store
 
@@ -49,14 +53,14 @@ func newServices(settingsFile string, swanAccess Access) *services {
 	swiftConfig := swift.NewConfig(settingsFile)
 	err := swiftConfig.Validate()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Use the file provided to get the OWID settings.
 	owidConfig := owid.NewConfig(settingsFile)
 	err = owidConfig.Validate()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Link to the SWIFT storage.
@@ -70,28 +74,61 @@ func newServices(settingsFile string, swanAccess Access) *services {
 	// Get the default browser detector.
 	b, err := swift.NewBrowserRegexes()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Create the swan configuration.
 	c := newConfig(settingsFile)
+	err = c.validateMessages()
+	if err != nil {
+		return nil, err
+	}
+	err = c.validateProfiles()
+	if err != nil {
+		return nil, err
+	}
+	err = c.validateReturnOrigins()
+	if err != nil {
+		return nil, err
+	}
+
+	// Load the OpenAPI document used to validate requests.
+	a, err := newOpenAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	// If results can only be decrypted once then record them in memory.
+	var n NonceStore
+	if c.SingleUseResults {
+		n = NewNonceMemory(c.NonceCacheSize)
+	}
 
 	// Return the services.
 	return &services{
 		c,
 		swift.NewServices(swiftConfig, swiftStoreSvc, swanAccess, b),
 		owid.NewServices(owidConfig, owidStore, swanAccess),
-		swanAccess}
+		swanAccess,
+		a,
+		n}, nil
 }
 
 // Returns true if the request is allowed to access the handler, otherwise
 // false. Removes the accessKey parameter from the form to prevent it being
 // used by other methods.  If false is returned then no further action is
-// needed as the method will have responded to the request already.
+// needed as the method will have responded to the request already. Requests
+// that have already been allowed are not checked again.
 func (s *services) getAccessAllowed(
 	w http.ResponseWriter,
 	r *http.Request) bool {
 
+	// The request has already been allowed if the access key is recorded in
+	// the request context.
+	if getAccessKey(r) != "" {
+		return true
+	}
+
 	// Check that there are no HTTP headers that are usually sent by browsers.
 	// SWAN can only be used from server side environments to ensure that the
 	// accessKey does not become publicly available.
@@ -107,7 +144,7 @@ func (s *services) getAccessAllowed(
 							"access key might be compromised if this "+
 							"configuration where to be made publicly available",
 						h),
-					http.StatusNetworkAuthenticationRequired)
+					ErrorCodeBrowserHeaderPresent)
 				return false
 			}
 		}
@@ -116,11 +153,7 @@ func (s *services) getAccessAllowed(
 	// Check that the domain for this request relates to a valid access node.
 	a, err := s.swift.GetAccessNodeForHost(r.Host)
 	if err != nil {
-		returnAPIError(
-			&s.config,
-			w,
-			err,
-			http.StatusBadRequest)
+		returnAPIError(&s.config, w, err, ErrorCodeInvalidAccessNode)
 		return false
 	}
 	if a == nil {
@@ -128,27 +161,30 @@ func (s *services) getAccessAllowed(
 			&s.config,
 			w,
 			fmt.Errorf("'%s' not a valid SWAN access node", r.Host),
-			http.StatusBadRequest)
+			ErrorCodeInvalidAccessNode)
 		return false
 	}
 
 	// Validate that the access key provided is valid in the access provider.
 	err = r.ParseForm()
 	if err != nil {
-		returnAPIError(&s.config, w, err, http.StatusInternalServerError)
+		returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
 		return false
 	}
-	v, err := s.access.GetAllowed(r.FormValue("accessKey"))
+	k := r.FormValue("accessKey")
+	v, err := s.access.GetAllowed(k)
 	if v == false || err != nil {
 		returnAPIError(&s.config, w,
 			fmt.Errorf("Access denied. Verify parameter accessKey"),
-			http.StatusNetworkAuthenticationRequired)
+			ErrorCodeAccessDenied)
 		return false
 	}
 
 	// Remove the access key to ensure it's not available to any further
-	// operations.
+	// operations. The key is retained in the request context so that the
+	// settings for the publisher can be found.
 	r.Form.Del("accessKey")
+	*r = *withAccessKey(r, k)
 
 	return true
 }
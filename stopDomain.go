@@ -0,0 +1,199 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The prefix used in a stopped domain to also stop all subdomains.
+const stopWildcard = "*."
+
+// normaliseStop returns the stop list entry for the value provided. Any scheme,
+// port, path, query or fragment is removed, the domain is converted to lower
+// case punycode, and the domain must be registrable or a subdomain of one. The
+// value can start with *. to include all subdomains. An error explaining why is
+// returned if the value can not be used.
+func normaliseStop(v string) (string, error) {
+	h := strings.ToLower(strings.TrimSpace(v))
+
+	// Remove any scheme, port, path, query or fragment.
+	if strings.Contains(h, "://") {
+		u, err := url.Parse(h)
+		if err != nil {
+			return "", stopError(v, "is not a valid URL")
+		}
+		h = u.Host
+	}
+	if i := strings.IndexAny(h, "/?#"); i >= 0 {
+		h = h[:i]
+	}
+	if i := strings.LastIndex(h, ":"); i >= 0 {
+		h = h[:i]
+	}
+	h = strings.TrimSuffix(h, ".")
+
+	// Remove any wildcard so that the domain can be validated.
+	w := strings.HasPrefix(h, stopWildcard)
+	h = strings.TrimPrefix(h, stopWildcard)
+	if h == "" {
+		return "", stopError(v, "does not contain a domain")
+	}
+	if net.ParseIP(h) != nil {
+		return "", stopError(v, "is an IP address and not a domain")
+	}
+
+	// Convert internationalised domains to punycode and check the labels are
+	// valid.
+	h, err := idna.Lookup.ToASCII(h)
+	if err != nil {
+		return "", stopError(v, "is not a valid domain")
+	}
+
+	// Check that the domain is registrable and not a public suffix.
+	s, icann := publicsuffix.PublicSuffix(h)
+	if icann == false && strings.Contains(s, ".") == false {
+		return "", stopError(v, "does not have a known public suffix")
+	}
+	if s == h {
+		return "", stopError(v, "is a public suffix")
+	}
+
+	if w {
+		return stopWildcard + h, nil
+	}
+	return h, nil
+}
+
+// normaliseStops returns the normalised and de-duplicated domains for the
+// values provided. Values that are not valid domains are ignored as they are
+// never present in stopped domains that have been rebuilt by parseStopped.
+func normaliseStops(v []string) []string {
+	n := make([]string, 0, len(v))
+	for _, i := range v {
+		s, err := normaliseStop(i)
+		if err == nil {
+			n = appendUnique(n, s)
+		}
+	}
+	return n
+}
+
+// getStopValue returns the SWIFT conflict character and the value to write to
+// the stopped domains for the stop, unstop and stopped values in the form,
+// removing them from the form. If the stopped domains previously returned by
+// decrypt are provided with a domain to stop or unstop then they are replaced
+// using the newest wins rule with the domain added, any unstopped domains
+// removed, and expired or excess entries pruned. Otherwise the domain is added
+// to the existing ones. Only the domain to stop must be a valid domain.
+// Entries in the stopped domains, or domains to unstop, that are not valid
+// domains are dropped. An empty conflict character is returned if there is
+// nothing to write.
+func getStopValue(c *Configuration, r *http.Request) (string, string, error) {
+	a := r.Form.Get("stop")
+	h := getHosts(r.Form["unstop"])
+	l, ok := r.Form["stopped"]
+	r.Form.Del("stop")
+	r.Form.Del("unstop")
+	r.Form.Del("stopped")
+	var err error
+	if a != "" {
+		a, err = normaliseStop(a)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	if ok && a == "" && len(h) == 0 {
+		return "", "", newError(
+			ErrorCodeInvalidRequest,
+			fmt.Errorf("'stopped' must be provided with 'stop' or 'unstop'"))
+	}
+	if len(h) > 0 {
+		if ok == false || len(l) == 0 {
+			return "", "", newError(
+				ErrorCodeMissingParameter,
+				fmt.Errorf("'stopped' must be provided with 'unstop'"))
+		}
+		h = normaliseStops(h)
+	}
+	if ok && len(l) > 0 {
+		e := removeStops(parseStopped(l), h)
+		if a != "" {
+			e = addStop(e, newStopEntry(a))
+		}
+		return ">", formatSnapshot(time.Now().UTC(), c.pruneStops(e)), nil
+	}
+	if a != "" {
+		return "+", formatStops([]*stopEntry{newStopEntry(a)}), nil
+	}
+	return "", "", nil
+}
+
+// parseStopped returns the entries from all the stopped values provided by the
+// caller with the domains normalised. If entries normalise to the same domain
+// then the newest is used. Entries added in the future are treated as added
+// now. Entries that are not valid domains, such as those written before
+// domains were validated, are dropped so that the stopped domains can always
+// be rewritten.
+func parseStopped(v []string) []*stopEntry {
+	e := parseStops(v, time.Time{})
+	t := time.Now().UTC()
+	n := make([]*stopEntry, 0, len(e))
+	m := make(map[string]*stopEntry)
+	for _, i := range e {
+		d, err := normaliseStop(i.domain)
+		if err != nil {
+			continue
+		}
+		if i.added.After(t) {
+			i.added = t
+		}
+		if o := m[d]; o != nil {
+			if i.added.After(o.added) {
+				o.added = i.added
+			}
+			continue
+		}
+		m[d] = &stopEntry{domain: d, added: i.added}
+		n = append(n, m[d])
+	}
+	return n
+}
+
+// appendUnique appends the value to the list if it is not already present.
+func appendUnique(l []string, v string) []string {
+	for _, i := range l {
+		if i == v {
+			return l
+		}
+	}
+	return append(l, v)
+}
+
+// stopError returns an invalid domain error with the reason.
+func stopError(v string, reason string) error {
+	return newError(
+		ErrorCodeInvalidDomain,
+		fmt.Errorf("stop domain '%s' %s", v, reason))
+}
@@ -0,0 +1,131 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/SWAN-community/swan-go"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StopEvaluation is the result of evaluating candidate domains against a
+// user's stopped domains. The candidates are returned as provided by the
+// caller.
+type StopEvaluation struct {
+	// The candidates that are stopped by the user.
+	Blocked []string `json:"blocked"`
+	// The candidates that are not stopped by the user.
+	Allowed []string `json:"allowed"`
+	// The candidates that are not valid domains mapped to the reason.
+	Invalid map[string]string `json:"invalid"`
+}
+
+// EvaluateStopList returns which of the candidate domains are blocked by the
+// stop pair returned from decrypt. The candidates and stopped domains are
+// normalised in the same way as when they are added to the stopped domains. A
+// stopped domain starting with *. also blocks all subdomains. A stop pair that
+// has expired is treated as empty as the stopped domains are no longer held by
+// the network.
+func EvaluateStopList(stop *swan.Pair, candidates []string) *StopEvaluation {
+	e := &StopEvaluation{
+		Blocked: make([]string, 0),
+		Allowed: make([]string, 0),
+		Invalid: make(map[string]string)}
+
+	// Get the normalised stopped domains ignoring any that are not valid.
+	l := make([]string, 0)
+	if stop != nil && isStopExpired(stop) == false {
+		e := parseStops([]string{stop.Value}, time.Time{})
+		for _, i := range stopDomains(e) {
+			n, err := normaliseStop(i)
+			if err == nil {
+				l = appendUnique(l, n)
+			}
+		}
+	}
+
+	// Check each of the candidates against the stopped domains.
+	for _, c := range candidates {
+		n, err := normaliseStop(c)
+		if err != nil {
+			e.Invalid[c] = err.Error()
+		} else if isStopped(l, n) {
+			e.Blocked = append(e.Blocked, c)
+		} else {
+			e.Allowed = append(e.Allowed, c)
+		}
+	}
+	return e
+}
+
+// isStopExpired returns true if the stop pair has an expiry date that has
+// passed.
+func isStopExpired(stop *swan.Pair) bool {
+	return stop.Expires.IsZero() == false &&
+		time.Now().UTC().After(stop.Expires)
+}
+
+// isStopped returns true if the normalised domain matches one of the
+// normalised stopped domains.
+func isStopped(l []string, d string) bool {
+	d = strings.TrimPrefix(d, stopWildcard)
+	for _, i := range l {
+		if strings.HasPrefix(i, stopWildcard) {
+			w := strings.TrimPrefix(i, stopWildcard)
+			if d == w || strings.HasSuffix(d, "."+w) {
+				return true
+			}
+		} else if d == i {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerEvaluateStop returns which of the candidate domains are blocked by the
+// stop pair previously returned by decrypt. See EvaluateStopList.
+func handlerEvaluateStop(s *services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check access and decode the JSON request body.
+		var q EvaluateStopRequest
+		if decodeRequest(s, w, r, &q) == false {
+			return
+		}
+
+		// Validate that the pair is the stop pair.
+		if q.Stop.Key != "stop" {
+			returnAPIError(
+				&s.config,
+				w,
+				fmt.Errorf("stop pair key must be 'stop'"),
+				ErrorCodeInvalidRequest)
+			return
+		}
+
+		// Evaluate the candidates and send the JSON response.
+		j, err := json.Marshal(EvaluateStopList(&q.Stop.Pair, q.Candidates))
+		if err != nil {
+			returnServerError(&s.config, w, err)
+			return
+		}
+		sendJSON(s, w, r, j)
+	}
+}
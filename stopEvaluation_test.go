@@ -0,0 +1,45 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"github.com/SWAN-community/swan-go"
+	"testing"
+	"time"
+)
+
+// TestEvaluateStopListExpired checks that the stopped domains of a stop pair
+// are only used until the pair expires.
+func TestEvaluateStopListExpired(t *testing.T) {
+	p := &swan.Pair{
+		Key:     "stop",
+		Value:   "a.com",
+		Expires: time.Now().UTC().Add(time.Hour)}
+
+	// The pair has not expired so the domain is blocked.
+	e := EvaluateStopList(p, []string{"a.com"})
+	if len(e.Blocked) != 1 {
+		t.Fatalf("expected 'a.com' to be blocked but got %v", e.Blocked)
+	}
+
+	// The pair has expired so the domain is allowed.
+	p.Expires = time.Now().UTC().Add(-time.Hour)
+	e = EvaluateStopList(p, []string{"a.com"})
+	if len(e.Blocked) != 0 || len(e.Allowed) != 1 {
+		t.Fatalf("expected 'a.com' to be allowed but got %v", e.Allowed)
+	}
+}
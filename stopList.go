@@ -0,0 +1,360 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"fmt"
+	"github.com/SWAN-community/swan-go"
+	"github.com/SWAN-community/swift-go"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The SWIFT key that holds the stopped domains with the time each was added and
+// any snapshots. Operators that do not support the stop list limits read the
+// values of the stop key as space separated domains, so the stop key continues
+// to hold only the domains and is written alongside this key by every storage
+// operation. The stopped domains are read from this key if the network holds a
+// value for it, otherwise from the stop key so that domains stopped before
+// this key was introduced are retained. Domains stopped through operators that
+// do not support this key after it has been written are not seen by those that
+// do, so all the operators in a network should be upgraded together.
+const stopListKey = "stops"
+
+// Separates a stopped domain from the date it was added in the values held by
+// SWIFT. Domains can never contain the character.
+const stopDateSeparator = ";"
+
+// The first entry of a value that contains the complete list of stopped
+// domains at the time the value was written. Entries in other values that
+// were added before the newest snapshot are ignored. As SWIFT merges the
+// values from every node when adding a domain a snapshot is the only way to
+// remove domains that nodes not visited by the operation still hold.
+const stopSnapshot = "-*"
+
+// The format of the time a domain was added. Older values contain only the
+// date.
+const stopTimeFormat = time.RFC3339Nano
+
+// stopEntry is a stopped domain and the date it was added. The date is zero if
+// it is not known.
+type stopEntry struct {
+	domain string
+	added  time.Time
+}
+
+// StoppedDomain is an entry in the structured stop list returned by decrypt
+// when requested.
+type StoppedDomain struct {
+	Domain string `json:"domain"`
+	// The date the entry was added. Entries added before dates were recorded
+	// use the time the stopped domains were last written.
+	Created time.Time `json:"created"`
+	// The time the entry will be removed from the network.
+	Expires time.Time `json:"expires"`
+}
+
+// StopPair is the stop pair returned by decrypt when the structured stop list
+// is requested. The Value remains the space separated list of domains for
+// compatibility with callers that do not use the Stopped list.
+type StopPair struct {
+	swan.Pair
+	Stopped []*StoppedDomain `json:"Stopped"`
+	// True if the values held by the network contain expired, excess or
+	// removed entries. SWIFT merges rather than replaces the values when a
+	// domain is added so they are only rewritten when the stopped value is
+	// provided with the next stop, unstop or update.
+	Compact bool `json:"Compact"`
+}
+
+// FormatStoppedDomains returns the structured stop list returned by decrypt as
+// the stopped value for stop, unstop and update. Unlike the space separated
+// domains in the stop pair value the dates the domains were added are retained
+// so that they can expire.
+func FormatStoppedDomains(l []*StoppedDomain) string {
+	e := make([]*stopEntry, 0, len(l))
+	for _, i := range l {
+		e = append(e, &stopEntry{domain: i.Domain, added: i.Created})
+	}
+	return formatStops(e)
+}
+
+// getStoppedDomains returns the structured stop list from the SWIFT stop pair
+// after any expired or excess entries have been pruned.
+func getStoppedDomains(c *Configuration, p *swift.Pair) []*StoppedDomain {
+	e := c.pruneStops(parseStops(getValues(p), p.Created()))
+	l := make([]*StoppedDomain, 0, len(e))
+	for _, i := range e {
+		x := p.Expires()
+		if c.StopExpiryDays > 0 {
+			x = i.added.AddDate(0, 0, c.StopExpiryDays)
+		}
+		l = append(l, &StoppedDomain{
+			Domain:  i.domain,
+			Created: i.added,
+			Expires: x})
+	}
+	return l
+}
+
+// isStopCompactable returns true if the values of the SWIFT stop pair contain
+// more entries than remain after expired, excess and removed entries have been
+// pruned. Entries without a date use the date d.
+func (c *Configuration) isStopCompactable(v []string, d time.Time) bool {
+	n := 0
+	for _, i := range v {
+		for _, f := range strings.Fields(i) {
+			if parseStop(f).domain != stopSnapshot {
+				n++
+			}
+		}
+	}
+	return n > len(c.pruneStops(parseStops(v, d)))
+}
+
+// getStopPair returns the SWIFT pair to read the stopped domains from. The stop
+// list key is used if the network holds a value for it, otherwise the stop key.
+func getStopPair(m map[string]*swift.Pair) *swift.Pair {
+	if p := m[stopListKey]; p != nil {
+		for _, i := range p.Values() {
+			if len(i) > 0 {
+				return p
+			}
+		}
+	}
+	return m["stop"]
+}
+
+// setStopValue sets the form to write the value v to the stop list key, and
+// the domains it contains to the stop key, with the SWIFT conflict character c
+// and the date t the values are removed from the network.
+func setStopValue(r *http.Request, c string, t string, v string) {
+	r.Form.Set(fmt.Sprintf("%s%s%s", stopListKey, c, t), v)
+	r.Form.Set(fmt.Sprintf("stop%s%s", c, t), getLegacyStops(v))
+}
+
+// getLegacyStops returns the domains in the value v written to the stop list
+// key as the value for the stop key. The dates and any snapshot are removed
+// so that operators that only read the stop key see domains alone.
+func getLegacyStops(v string) string {
+	d := make([]string, 0)
+	for _, f := range strings.Fields(v) {
+		n := parseStop(f)
+		if n.domain != stopSnapshot {
+			d = append(d, n.domain)
+		}
+	}
+	return strings.Join(d, listSeparator)
+}
+
+// getValues returns the values of the SWIFT pair as strings.
+func getValues(p *swift.Pair) []string {
+	v := make([]string, 0, len(p.Values()))
+	for _, i := range p.Values() {
+		v = append(v, string(i))
+	}
+	return v
+}
+
+// parseStops returns the entries contained in the values. Each value is one
+// written to SWIFT and can contain entries separated by the listSeparator. If
+// any of the values is a snapshot then only the entries in the newest snapshot
+// and those added since are used. Entries without a valid date use the date d.
+// If a domain appears more than once then the newest entry is used.
+func parseStops(v []string, d time.Time) []*stopEntry {
+	e := make([]*stopEntry, 0)
+	m := make(map[string]*stopEntry)
+	var s time.Time
+	for _, i := range v {
+		if t, ok := getSnapshot(i); ok && t.After(s) {
+			s = t
+		}
+	}
+	for _, i := range v {
+		t, ok := getSnapshot(i)
+		c := ok && t.Equal(s)
+		for _, f := range strings.Fields(i) {
+			n := parseStop(f)
+			if n.domain == "" || n.domain == stopSnapshot {
+				continue
+			}
+			if c == false && n.added.Before(s) {
+				continue
+			}
+			if n.added.IsZero() {
+				n.added = d
+			}
+			k := strings.ToLower(n.domain)
+			if o := m[k]; o != nil {
+				if n.added.After(o.added) {
+					o.added = n.added
+				}
+			} else {
+				m[k] = n
+				e = append(e, n)
+			}
+		}
+	}
+	return e
+}
+
+// parseStop returns the entry for the field f. The time added is zero if the
+// field does not contain a valid time or date.
+func parseStop(f string) *stopEntry {
+	n := &stopEntry{domain: f}
+	if x := strings.Index(f, stopDateSeparator); x >= 0 {
+		n.domain = f[:x]
+		t, err := time.Parse(stopTimeFormat, f[x+1:])
+		if err != nil {
+			t, err = time.Parse("2006-01-02", f[x+1:])
+		}
+		if err == nil {
+			n.added = t.UTC()
+		}
+	}
+	return n
+}
+
+// getSnapshot returns the time of the snapshot and true if the value is a
+// snapshot, otherwise false.
+func getSnapshot(v string) (time.Time, bool) {
+	f := strings.Fields(v)
+	if len(f) == 0 {
+		return time.Time{}, false
+	}
+	n := parseStop(f[0])
+	if n.domain != stopSnapshot || n.added.IsZero() {
+		return time.Time{}, false
+	}
+	return n.added, true
+}
+
+// formatStops returns the entries as a single value for SWIFT with each entry
+// separated by the listSeparator. The time is included if known.
+func formatStops(e []*stopEntry) string {
+	v := make([]string, 0, len(e))
+	for _, i := range e {
+		if i.added.IsZero() {
+			v = append(v, i.domain)
+		} else {
+			v = append(v, i.domain+stopDateSeparator+
+				i.added.Format(stopTimeFormat))
+		}
+	}
+	return strings.Join(v, listSeparator)
+}
+
+// formatSnapshot returns the entries as a snapshot value for SWIFT written at
+// time t.
+func formatSnapshot(t time.Time, e []*stopEntry) string {
+	return formatStops(append(
+		[]*stopEntry{{domain: stopSnapshot, added: t}},
+		e...))
+}
+
+// stopDomains returns the domains of the entries.
+func stopDomains(e []*stopEntry) []string {
+	v := make([]string, 0, len(e))
+	for _, i := range e {
+		v = append(v, i.domain)
+	}
+	return v
+}
+
+// newStopEntry returns an entry for the domain added now.
+func newStopEntry(d string) *stopEntry {
+	return &stopEntry{domain: d, added: time.Now().UTC()}
+}
+
+// addStop returns the entries with the new entry added, replacing any existing
+// entry for the same domain.
+func addStop(e []*stopEntry, n *stopEntry) []*stopEntry {
+	return append(removeStops(e, []string{n.domain}), n)
+}
+
+// removeStops returns the entries without any of the domains provided.
+func removeStops(e []*stopEntry, domains []string) []*stopEntry {
+	v := make([]*stopEntry, 0, len(e))
+	for _, i := range e {
+		f := false
+		for _, d := range domains {
+			if strings.EqualFold(i.domain, d) {
+				f = true
+				break
+			}
+		}
+		if f == false {
+			v = append(v, i)
+		}
+	}
+	return v
+}
+
+// pruneStops removes entries that have been held for longer than the
+// configured expiry and then, if there are more entries than the configured
+// maximum, removes the oldest entries. Entries without a date never expire and
+// are treated as the oldest.
+func (c *Configuration) pruneStops(e []*stopEntry) []*stopEntry {
+	v := make([]*stopEntry, 0, len(e))
+	n := time.Now().UTC()
+	for _, i := range e {
+		if c.StopExpiryDays > 0 &&
+			i.added.IsZero() == false &&
+			n.After(i.added.AddDate(0, 0, c.StopExpiryDays)) {
+			continue
+		}
+		v = append(v, i)
+	}
+	if c.StopMaxEntries > 0 && len(v) > c.StopMaxEntries {
+		sort.SliceStable(v, func(a, b int) bool {
+			return v[a].added.Before(v[b].added)
+		})
+		v = v[len(v)-c.StopMaxEntries:]
+	}
+	return v
+}
+
+// getDecrypted returns the SWAN pairs for the SWIFT results. If l is true then
+// the stop pair is returned as a StopPair including the structured stop list.
+func getDecrypted(
+	s *services,
+	r *http.Request,
+	o *swift.Results,
+	l bool) ([]interface{}, error) {
+	m := o.Map()
+	p, err := convertPairs(s, r, m)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]interface{}, 0, len(p))
+	x := getStopPair(m)
+	for _, i := range p {
+		if l && i.Key == "stop" && x != nil {
+			v = append(v, &StopPair{
+				Pair:    *i,
+				Stopped: getStoppedDomains(&s.config, x),
+				Compact: s.config.isStopCompactable(
+					getValues(x),
+					x.Created())})
+		} else {
+			v = append(v, i)
+		}
+	}
+	return v, nil
+}
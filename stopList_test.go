@@ -0,0 +1,159 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestUnstopNotRevived checks that a domain removed by unstop is not restored
+// when a later stop merges the values still held by nodes the unstop did not
+// visit.
+func TestUnstopNotRevived(t *testing.T) {
+	var c Configuration
+
+	// The value held by a node that the unstop operation does not visit.
+	o := formatStops([]*stopEntry{
+		{domain: "a.com", added: time.Now().UTC().Add(-time.Hour)},
+		{domain: "b.com", added: time.Now().UTC().Add(-time.Hour)}})
+
+	// Remove b.com using the list previously returned by decrypt.
+	r := &http.Request{Form: url.Values{
+		"unstop":  {"b.com"},
+		"stopped": {"a.com b.com"}}}
+	k, u, err := getStopValue(&c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != ">" {
+		t.Fatalf("expected '>' but got '%s'", k)
+	}
+
+	// Add c.com which SWIFT merges with the values from all the nodes.
+	r = &http.Request{Form: url.Values{"stop": {"c.com"}}}
+	k, a, err := getStopValue(&c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != "+" {
+		t.Fatalf("expected '+' but got '%s'", k)
+	}
+
+	// Check that b.com remains removed whatever the order of the values.
+	for _, v := range [][]string{{o, u, a}, {a, u, o}, {u, o, a}} {
+		d := stopDomains(parseStops(v, time.Time{}))
+		if len(d) != 2 || isStopped(d, "b.com") ||
+			isStopped(d, "a.com") == false ||
+			isStopped(d, "c.com") == false {
+			t.Fatalf("expected a.com and c.com but got %v", d)
+		}
+	}
+}
+
+// TestStopWritePruned checks that values holding more than the maximum number
+// of entries are reported as compactable and that providing the stopped
+// domains with the next stop writes at most the maximum number of entries.
+func TestStopWritePruned(t *testing.T) {
+	c := Configuration{StopMaxEntries: 2}
+	n := time.Now().UTC()
+
+	// Values added by separate stop operations and merged by SWIFT.
+	v := []string{
+		formatStops([]*stopEntry{{domain: "a.com", added: n.Add(-3 * time.Hour)}}),
+		formatStops([]*stopEntry{{domain: "b.com", added: n.Add(-2 * time.Hour)}}),
+		formatStops([]*stopEntry{{domain: "c.com", added: n.Add(-time.Hour)}})}
+	if c.isStopCompactable(v, time.Time{}) == false {
+		t.Fatal("expected values to be compactable")
+	}
+
+	// Stop d.com providing the stopped domains returned by decrypt.
+	r := &http.Request{Form: url.Values{
+		"stop":    {"d.com"},
+		"stopped": {formatStops(c.pruneStops(parseStops(v, time.Time{})))}}}
+	k, s, err := getStopValue(&c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k != ">" {
+		t.Fatalf("expected '>' but got '%s'", k)
+	}
+
+	// Once merged with the values of nodes not visited only the newest two
+	// domains remain and the values are not compactable.
+	d := stopDomains(parseStops([]string{s}, time.Time{}))
+	if len(d) != 2 || d[0] != "c.com" || d[1] != "d.com" {
+		t.Fatalf("expected c.com and d.com but got %v", d)
+	}
+	if c.isStopCompactable([]string{s}, time.Time{}) {
+		t.Fatal("expected snapshot not to be compactable")
+	}
+	d = stopDomains(c.pruneStops(parseStops(append(v, s), time.Time{})))
+	if len(d) != 2 || isStopped(d, "a.com") || isStopped(d, "b.com") {
+		t.Fatalf("expected c.com and d.com but got %v", d)
+	}
+}
+
+// TestStoppedInvalidEntries checks that entries in the stopped domains that are
+// not valid domains, such as those written before domains were validated, do
+// not prevent the stopped domains being rewritten and can be unstopped.
+func TestStoppedInvalidEntries(t *testing.T) {
+	var c Configuration
+	for _, f := range []url.Values{
+		{"unstop": {"foo"}, "stopped": {"foo a.com localhost"}},
+		{"stop": {"b.com"}, "stopped": {"foo a.com localhost"}}} {
+		r := &http.Request{Form: f}
+		k, v, err := getStopValue(&c, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k != ">" {
+			t.Fatalf("expected '>' but got '%s'", k)
+		}
+		d := stopDomains(parseStops([]string{v}, time.Time{}))
+		if isStopped(d, "a.com") == false ||
+			isStopped(d, "foo") ||
+			isStopped(d, "localhost") {
+			t.Fatalf("expected invalid entries to be dropped but got %v", d)
+		}
+	}
+}
+
+// TestStopLegacyValue checks that the stop key is written with domains alone so
+// that operators that only read the stop key do not see dates or snapshots.
+func TestStopLegacyValue(t *testing.T) {
+	var c Configuration
+	r := &http.Request{Form: url.Values{
+		"stop":    {"b.com"},
+		"stopped": {"a.com;2021-01-02"}}}
+	k, v, err := getStopValue(&c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setStopValue(r, k, "2030-01-01", v)
+	if r.Form.Get(stopListKey+">2030-01-01") != v {
+		t.Fatalf("expected stop list value '%s'", v)
+	}
+	if l := r.Form.Get("stop>2030-01-01"); l != "a.com b.com" {
+		t.Fatalf("expected 'a.com b.com' but got '%s'", l)
+	}
+	if e := getExpires(r.Form); len(e) != 1 || e["stop"].IsZero() {
+		t.Fatalf("expected only the stop key to expire but got %v", e)
+	}
+}
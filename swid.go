@@ -31,11 +31,11 @@ func createSWID(s *services, r *http.Request) (*owid.OWID, error) {
 		return nil, err
 	}
 	if c == nil {
-		return nil, fmt.Errorf(
+		return nil, newError(ErrorCodeNoCreator, fmt.Errorf(
 			"No SWID creator available for host '%s'. "+
 				"Try http[s]://%s/owid/register",
 			r.Host,
-			r.Host)
+			r.Host))
 	}
 	u, err := uuid.New().MarshalBinary()
 	if err != nil {
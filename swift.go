@@ -29,21 +29,29 @@ import (
 
 // createStorageOperationURL returns a URL to redirect the web browser to that
 // will perform the storage operation requested.
-// s instance of the SWIFT services that are mapped to this SWAN Operator
+// s instance of the SWAN services containing the SWIFT services that are mapped
+// to this SWAN Operator
 // r the current HTTP request from the web browser
 // q key value pairs to include in the query, updated by the method
 func createStorageOperationURL(
-	s *swift.Services,
+	s *services,
 	r *http.Request,
 	q url.Values) (string, error) {
 
-	// Add the HTTP headers that will impact the home node calculation.
-	swift.SetHomeNodeHeaders(r, &q)
+	// Add the HTTP headers that will impact the home node calculation. Values
+	// for the web browser provided by the caller take precedence over the
+	// request which is from the caller's server.
+	if q.Get("remoteAddr") == "" && q.Get("X-Forwarded-For") == "" {
+		swift.SetHomeNodeHeaders(r, &q)
+	}
 
 	// Set the table to SWAN overriding any current value.
 	q.Set("table", "swan")
 
-	return swift.Create(s, r.Host, q)
+	// Bind the results to the publisher that initiated the operation.
+	s.config.setBinding(r, q)
+
+	return swift.Create(s.swift, r.Host, q)
 }
 
 // decrypt uses the SWIFT service for this access node to decrypt the data as
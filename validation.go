@@ -0,0 +1,282 @@
+/* ****************************************************************************
+ * Copyright 2020 51 Degrees Mobile Experts Limited (51degrees.com)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not
+ * use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+ * License for the specific language governing permissions and limitations
+ * under the License.
+ * ***************************************************************************/
+
+package swanop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// validate returns a handler that checks the request conforms to the OpenAPI
+// document before passing it to the handler provided. Requests that are not
+// valid are rejected with the same error response as the handlers use so that
+// callers see consistent errors irrespective of where the problem is found.
+// Access is checked before the request is validated.
+func validate(s *services, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// Check the caller is authorized to access SWAN before any other
+		// validation so that callers without a valid access key are not given
+		// details of the parameters or body expected.
+		if s.getAccessAllowed(w, r) == false {
+			return
+		}
+
+		// Get the operation for the path and method.
+		o, err := s.api.getOperation(r.URL.Path, r.Method)
+		if err != nil {
+			returnAPIError(&s.config, w, err, ErrorCodeMethodNotAllowed)
+			return
+		}
+
+		// Validate the request if the operation is described.
+		if o != nil {
+			err = validateRequest(s.api, w, r, o)
+			if err != nil {
+				returnAPIError(&s.config, w, err, ErrorCodeInvalidRequest)
+				return
+			}
+		}
+
+		h(w, r)
+	}
+}
+
+// validateRequest checks the parameters and any JSON body of the request
+// against the operation.
+func validateRequest(
+	a *openAPI,
+	w http.ResponseWriter,
+	r *http.Request,
+	o *apiOperation) error {
+
+	// Parse the query string and any form body so the parameters can be
+	// checked. The handlers will use the parsed form.
+	err := r.ParseForm()
+	if err != nil {
+		return newError(ErrorCodeInvalidRequest, err)
+	}
+
+	// Check each of the parameters. The access key has already been checked
+	// and removed from the form.
+	for _, p := range o.Parameters {
+		if p.Name == "accessKey" {
+			continue
+		}
+		err = validateParameter(p, r.Form[p.Name])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Check the body if the operation has one.
+	if o.RequestBody != nil {
+		err = validateBody(a, w, r, o)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateParameter checks that required parameters are present and that the
+// values provided match the parameter's schema. Empty values are treated as
+// missing.
+func validateParameter(p *apiParameter, v []string) error {
+	if len(v) == 0 || v[0] == "" {
+		if p.Required {
+			c := p.ErrorCode
+			if c == "" {
+				c = ErrorCodeMissingParameter
+			}
+			return newError(c, fmt.Errorf("'%s' must be provided", p.Name))
+		}
+		return nil
+	}
+	if p.Schema == nil {
+		return nil
+	}
+	for _, i := range v {
+		err := validateParameterValue(p, i)
+		if err != nil {
+			return newError(ErrorCodeInvalidRequest, err)
+		}
+	}
+	return nil
+}
+
+// validateParameterValue checks a single parameter value against the schema.
+func validateParameterValue(p *apiParameter, v string) error {
+	s := p.Schema
+	switch s.Type {
+	case "boolean":
+		if v != "true" && v != "false" {
+			return fmt.Errorf("'%s' must be true or false", p.Name)
+		}
+	case "integer":
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("'%s' must be an integer", p.Name)
+		}
+		err = validateRange(p.Name, s, float64(i))
+		if err != nil {
+			return err
+		}
+	}
+	return validateEnum(p.Name, s, v)
+}
+
+// validateBody checks that the body is JSON and matches the schema of the
+// operation. The body is replaced so that it can be read again by the handler.
+func validateBody(
+	a *openAPI,
+	w http.ResponseWriter,
+	r *http.Request,
+	o *apiOperation) error {
+	if strings.HasPrefix(
+		r.Header.Get("Content-Type"),
+		"application/json") == false {
+		return newError(
+			ErrorCodeInvalidRequest,
+			fmt.Errorf("Content-Type must be application/json"))
+	}
+	c, ok := o.RequestBody.Content["application/json"]
+	if ok == false {
+		return newError(
+			ErrorCodeInvalidRequest,
+			fmt.Errorf("JSON body not supported"))
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	if err != nil {
+		return newError(ErrorCodeInvalidRequest, err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	err = d.Decode(&v)
+	if err != nil {
+		return newError(ErrorCodeInvalidRequest, err)
+	}
+	err = validateJSON(a, c.Schema, v, "body")
+	if err != nil {
+		return newError(ErrorCodeInvalidRequest, err)
+	}
+	return nil
+}
+
+// validateJSON checks the JSON value against the schema. The path is used to
+// identify the value in any error message.
+func validateJSON(a *openAPI, s *apiSchema, v interface{}, path string) error {
+	s = a.getSchema(s)
+	if s == nil || v == nil {
+		return nil
+	}
+	switch s.Type {
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if ok == false {
+			return fmt.Errorf("'%s' must be an object", path)
+		}
+		for _, k := range s.Required {
+			if m[k] == nil {
+				return fmt.Errorf("'%s.%s' must be provided", path, k)
+			}
+		}
+		for k, i := range m {
+			p := s.Properties[k]
+			if p == nil {
+				if s.AdditionalProperties == false {
+					return fmt.Errorf("'%s.%s' is not supported", path, k)
+				}
+				continue
+			}
+			err := validateJSON(a, p, i, path+"."+k)
+			if err != nil {
+				return err
+			}
+		}
+	case "array":
+		l, ok := v.([]interface{})
+		if ok == false {
+			return fmt.Errorf("'%s' must be an array", path)
+		}
+		for n, i := range l {
+			err := validateJSON(a, s.Items, i, fmt.Sprintf("%s[%d]", path, n))
+			if err != nil {
+				return err
+			}
+		}
+	case "string":
+		i, ok := v.(string)
+		if ok == false {
+			return fmt.Errorf("'%s' must be a string", path)
+		}
+		return validateEnum(path, s, i)
+	case "integer":
+		n, ok := v.(json.Number)
+		if ok == false {
+			return fmt.Errorf("'%s' must be an integer", path)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return fmt.Errorf("'%s' must be an integer", path)
+		}
+		return validateRange(path, s, float64(i))
+	case "boolean":
+		_, ok := v.(bool)
+		if ok == false {
+			return fmt.Errorf("'%s' must be true or false", path)
+		}
+	}
+	return nil
+}
+
+// validateEnum checks the value is one of the enumerated values if the schema
+// has any.
+func validateEnum(name string, s *apiSchema, v string) error {
+	if len(s.Enum) == 0 {
+		return nil
+	}
+	for _, e := range s.Enum {
+		if e == v {
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"'%s' must be one of %s",
+		name,
+		strings.Join(s.Enum, ", "))
+}
+
+// validateRange checks the value is within the minimum and maximum if the
+// schema has them.
+func validateRange(name string, s *apiSchema, v float64) error {
+	if s.Minimum != nil && v < *s.Minimum {
+		return fmt.Errorf("'%s' must be at least %g", name, *s.Minimum)
+	}
+	if s.Maximum != nil && v > *s.Maximum {
+		return fmt.Errorf("'%s' must be at most %g", name, *s.Maximum)
+	}
+	return nil
+}